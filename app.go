@@ -29,9 +29,13 @@ func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
 	a.Items = []backend.UserClip{}
 	callback := &backend.CallBack{
-		KeepAlive:   a.OnKeepAliveCallback,
-		OnRaid:      a.OnRaidCallback,
-		OnConnected: a.OnConnectedCallback,
+		KeepAlive:    a.OnKeepAliveCallback,
+		OnRaid:       a.OnRaidCallback,
+		OnConnected:  a.OnConnectedCallback,
+		OnRedemption: a.OnRedemptionCallback,
+		OnPlaylist:   a.OnPlaylistCallback,
+		OnPlayback:   a.OnPlaybackCallback,
+		OnServeError: a.OnServeErrorCallback,
 	}
 	a.Backend = backend.NewBackend(callback)
 	go a.Backend.Serve()
@@ -41,10 +45,48 @@ func (a *App) StartClip(url string, duration float32) {
 	a.Backend.Overlay.StartClip(url, duration)
 }
 
+// クリップのIDがあればmp4が再生できないときに埋め込みプレイヤーで再生し直す
+func (a *App) StartUserClip(clip backend.UserClip) {
+	a.Backend.Overlay.StartUserClip(&clip)
+}
+
+func (a *App) GetPlayback() backend.PlaybackState {
+	return a.Backend.Overlay.Playback()
+}
+
+// オーバーレイのサーバを起動できなかったときの理由
+func (a *App) GetOverlayError() string {
+	return a.Backend.Overlay.ServeError()
+}
+
 func (a *App) StopClip() {
 	a.Backend.Overlay.StopClip()
 }
 
+func (a *App) QueueClips(clips []backend.UserClip) {
+	a.Backend.Playlist.Enqueue(clips)
+}
+
+func (a *App) GetPlaylist() backend.PlaylistState {
+	return a.Backend.Playlist.State()
+}
+
+func (a *App) PlaylistNext() {
+	a.Backend.Playlist.Next()
+}
+
+func (a *App) PlaylistPrev() {
+	a.Backend.Playlist.Prev()
+}
+
+func (a *App) PlaylistSkip() {
+	a.Backend.Playlist.Skip()
+}
+
+func (a *App) PlaylistClear() {
+	a.Backend.Playlist.Clear()
+}
+
 func (a *App) LoadConfig() *AppConfig {
 	ret := &AppConfig{ConfigBody: *a.Backend.LoadConfig()}
 	return ret
@@ -104,6 +146,92 @@ func (a *App) OpenDiectoryDialog(prev string) string {
 	return selected
 }
 
+func (a *App) UserHistory(login string) *backend.UserHistory {
+	ret, err := a.Backend.UserHistory(login)
+	if err != nil {
+		runtime.LogError(a.ctx, fmt.Sprintf("UserHistory error: %v", err))
+		return nil
+	}
+	return ret
+}
+
+func (a *App) MonthlyTotals() []backend.MonthlyTotal {
+	ret, err := a.Backend.MonthlyTotals()
+	if err != nil {
+		runtime.LogError(a.ctx, fmt.Sprintf("MonthlyTotals error: %v", err))
+		return []backend.MonthlyTotal{}
+	}
+	return ret
+}
+
+func (a *App) ReturningViewers() []string {
+	ret, err := a.Backend.ReturningViewers()
+	if err != nil {
+		runtime.LogError(a.ctx, fmt.Sprintf("ReturningViewers error: %v", err))
+		return []string{}
+	}
+	return ret
+}
+
+func (a *App) ListChannelRewards() []backend.ChannelPoint {
+	return a.Backend.ListChannelRewards()
+}
+
+// 以下の報酬操作は失敗したときにエラー内容を返す(成功なら空文字)
+func errorText(ctx context.Context, name string, err error) string {
+	if err == nil {
+		return ""
+	}
+	runtime.LogError(ctx, fmt.Sprintf("%v error: %v", name, err))
+	return err.Error()
+}
+
+func (a *App) CreateChannelReward(p backend.ChannelPoint) string {
+	_, err := a.Backend.CreateChannelReward(&p)
+	return errorText(a.ctx, "CreateChannelReward", err)
+}
+
+func (a *App) UpdateChannelReward(p backend.ChannelPoint) string {
+	_, err := a.Backend.UpdateChannelReward(&p)
+	return errorText(a.ctx, "UpdateChannelReward", err)
+}
+
+func (a *App) DeleteChannelReward(id string) string {
+	return errorText(a.ctx, "DeleteChannelReward", a.Backend.DeleteChannelReward(id))
+}
+
+func (a *App) PauseChannelReward(id string, paused bool) string {
+	return errorText(a.ctx, "PauseChannelReward", a.Backend.PauseChannelReward(id, paused))
+}
+
+func (a *App) EnableChannelReward(id string, enabled bool) string {
+	return errorText(a.ctx, "EnableChannelReward", a.Backend.EnableChannelReward(id, enabled))
+}
+
+func (a *App) ApplyRewardSet(name string, online bool) string {
+	return errorText(a.ctx, "ApplyRewardSet", a.Backend.ApplyRewardSet(name, online))
+}
+
+func (a *App) ListRedemptions() []backend.Redemption {
+	return a.Backend.ListRedemptions()
+}
+
+func (a *App) FulfillRedemption(id string) string {
+	return errorText(a.ctx, "FulfillRedemption", a.Backend.FulfillRedemption(id))
+}
+
+func (a *App) CancelRedemption(id string) string {
+	return errorText(a.ctx, "CancelRedemption", a.Backend.CancelRedemption(id))
+}
+
+func (a *App) ReloadScripts() string {
+	return errorText(a.ctx, "ReloadScripts", a.Backend.ReloadScripts())
+}
+
+func (a *App) ExportOverlayPages() string {
+	return errorText(a.ctx, "ExportOverlayPages", a.Backend.ExportOverlayPages())
+}
+
 func (a *App) OnKeepAliveCallback() {
 	//runtime.LogDebug(a.ctx, "KeepAlive")
 	//runtime.EventsEmit(a.ctx, "testevent", "event from backend", a.Items)
@@ -117,6 +245,24 @@ func (a *App) OnRaidCallback(param *backend.RaidCallbackParam) {
 	//runtime.EventsEmit(a.ctx, "OnRaid", "raided users clip", param.From, param.Clips)
 }
 
+// event は started / ended / changed
+func (a *App) OnPlaylistCallback(event string, state backend.PlaylistState) {
+	runtime.EventsEmit(a.ctx, "OnPlaylist", event, state)
+}
+
+func (a *App) OnPlaybackCallback(state backend.PlaybackState) {
+	runtime.EventsEmit(a.ctx, "OnPlayback", state)
+}
+
+// 空文字なら待ち受けできている
+func (a *App) OnServeErrorCallback(msg string) {
+	runtime.EventsEmit(a.ctx, "OnOverlayError", msg)
+}
+
+func (a *App) OnRedemptionCallback(items []backend.Redemption) {
+	runtime.EventsEmit(a.ctx, "OnRedemptionQueue", items)
+}
+
 func (a *App) OnConnectedCallback() {
 	runtime.LogDebug(a.ctx, "Connected")
 	runtime.EventsEmit(a.ctx, "OnConnected", "connected")
@@ -152,5 +298,6 @@ func (a *App) DebugRaidTest(userName string) {
 		})
 		runtime.LogDebug(a.ctx, fmt.Sprintf("found clip [%v]", c.Title))
 	}
+	a.Backend.Overlay.ClipCache.Prefetch(data)
 	runtime.EventsEmit(a.ctx, "OnRaid", "raided users clip", diplayName, data)
 }
@@ -0,0 +1,163 @@
+package backend
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"log/slog"
+	"strings"
+	"text/template"
+)
+
+const (
+	AlertFollow     = "follow"
+	AlertSub        = "sub"
+	AlertReSub      = "resub"
+	AlertGift       = "gift"
+	AlertCheer      = "cheer"
+	AlertRaid       = "raid"
+	AlertRedemption = "redemption"
+	AlertRule       = "rule" // ルールの alert アクション。Message に TEXT を埋めたものが入る
+
+	AlertAnonymousName = "匿名"
+	AlertOverlayEvent  = "alertbox"
+)
+
+// イベントごとのアラートの見た目
+// TEXT は text/template で Alert の項目を埋め込める(例: {{.User}} {{.Amount}})
+// IMAGE/SOUND はローカルのファイルかURL
+type AlertStyle struct {
+	Event     string `yaml:"EVENT"`
+	Text      string `yaml:"TEXT"`
+	Image     string `yaml:"IMAGE"`
+	Sound     string `yaml:"SOUND"`
+	Seconds   int    `yaml:"SECONDS"`
+	MinAmount int    `yaml:"MIN_AMOUNT"` // cheer/gift/raid でこれ未満なら出さない
+}
+
+// ハンドラから渡す内容
+// Amount は cheer ならビッツ、gift なら個数、raid なら人数
+type Alert struct {
+	Event   string `json:"event"`
+	User    string `json:"user"`
+	Amount  int    `json:"amount"`
+	Tier    string `json:"tier"`
+	Months  int    `json:"months"`
+	Message string `json:"message"`
+	Reward  string `json:"reward"`
+}
+
+// オーバーレイに送る内容
+type AlertCard struct {
+	Alert
+	Text    string `json:"text"`
+	Image   string `json:"image"`
+	Sound   string `json:"sound"`
+	Seconds int    `json:"seconds"`
+}
+
+var DefaultAlertStyles = []AlertStyle{
+	{Event: AlertFollow, Text: "{{.User}} さん、フォローありがとう！", Seconds: 5},
+	{Event: AlertSub, Text: "{{.User}} さん、サブスクありがとう！", Seconds: 5},
+	{Event: AlertReSub, Text: "{{.User}} さん、{{.Months}}か月目のサブスクありがとう！", Seconds: 5},
+	{Event: AlertGift, Text: "{{.User}} さんから {{.Amount}} 個のサブギフ！", Seconds: 5},
+	{Event: AlertCheer, Text: "{{.User}} さん、{{.Amount}} ビッツありがとう！", Seconds: 5},
+	{Event: AlertRaid, Text: "{{.User}} さんが {{.Amount}} 人でレイド！", Seconds: 8},
+	{Event: AlertRedemption, Text: "{{.User}} さんが「{{.Reward}}」を引き換え", Seconds: 5},
+	{Event: AlertRule, Text: "{{.Message}}", Seconds: 5},
+}
+
+//go:embed overlay/alerts.html
+var AlertsHtml string
+
+func findAlertStyle(styles []AlertStyle, event string) (*AlertStyle, bool) {
+	for i := range styles {
+		if styles[i].Event == event {
+			return &styles[i], true
+		}
+	}
+	return nil, false
+}
+
+func renderAlertText(text string, a *Alert) string {
+	t, err := template.New("alert").Parse(text)
+	if err != nil {
+		logger.Error("renderAlertText::Parse", slog.Any("text", text), slog.Any("ERR", err.Error()))
+		return text
+	}
+	buf := &bytes.Buffer{}
+	if err := t.Execute(buf, a); err != nil {
+		logger.Error("renderAlertText::Execute", slog.Any("text", text), slog.Any("ERR", err.Error()))
+		return text
+	}
+	return buf.String()
+}
+
+// URLはそのまま、ローカルのファイルはオーバーレイから読めるようにする
+func (o *OverlayContext) mediaUrl(path string) string {
+	if path == "" || strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return path
+	}
+	return o.PublishMedia(path)
+}
+
+// 出さないとき(スタイルが無い、MIN_AMOUNT未満)は false
+func (o *OverlayContext) buildAlertCard(styles []AlertStyle, a Alert) (*AlertCard, bool) {
+	style, exists := findAlertStyle(styles, a.Event)
+	// rule を足す前の設定でもルールのアラートは出す
+	if !exists && a.Event == AlertRule {
+		style, exists = findAlertStyle(DefaultAlertStyles, AlertRule)
+	}
+	if !exists || a.Amount < style.MinAmount {
+		return nil, false
+	}
+	if a.User == "" {
+		a.User = AlertAnonymousName
+	}
+	return &AlertCard{
+		Alert:   a,
+		Text:    renderAlertText(style.Text, &a),
+		Image:   o.mediaUrl(style.Image),
+		Sound:   o.mediaUrl(style.Sound),
+		Seconds: style.Seconds,
+	}, true
+}
+
+var ErrAlertSkipped = errors.New("alert skipped by style")
+
+// ハンドラから呼ばれる。オーバーレイが開かれていなくても待たない
+func (c *BackendContext) PushAlert(a Alert) {
+	c.TryPushAlert(a)
+}
+
+// ルールのアクションなど、出せなかったことを知りたいとき用
+func (c *BackendContext) TryPushAlert(a Alert) error {
+	card, ok := c.Overlay.buildAlertCard(c.Config.AlertStyles(), a)
+	if !ok {
+		return ErrAlertSkipped
+	}
+	c.Overlay.alertMu.Lock()
+	c.Overlay.lastAlert = card
+	c.Overlay.alertMu.Unlock()
+	n := c.Overlay.Hub.Publish(AlertOverlayEvent, card)
+	logger.Info("PushAlert", slog.Any("event", a.Event), slog.Any("user", card.User), slog.Any("clients", n))
+	if n == 0 {
+		return ErrOverlayNotConnected
+	}
+	return nil
+}
+
+var ErrNoAlert = errors.New("no alert to replay")
+
+// 最後に出したアラートをもう一度出す
+func (o *OverlayContext) ReplayAlert() error {
+	o.alertMu.Lock()
+	card := o.lastAlert
+	o.alertMu.Unlock()
+	if card == nil {
+		return ErrNoAlert
+	}
+	n := o.Hub.Publish(AlertOverlayEvent, card)
+	logger.Info("ReplayAlert", slog.Any("event", card.Event), slog.Any("user", card.User), slog.Any("clients", n))
+	return nil
+}
@@ -0,0 +1,56 @@
+package backend
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestBuildAlertCard(t *testing.T) {
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	sut := NewOverlay(nil)
+	styles := []AlertStyle{
+		{Event: AlertCheer, Text: "{{.User}} {{.Amount}} bits", Image: "C:\\img\\cheer.gif", Sound: "https://example.com/cheer.mp3", Seconds: 3, MinAmount: 100},
+		{Event: AlertReSub, Text: "{{.User}} {{.Months}}", Seconds: 5},
+	}
+
+	if _, ok := sut.buildAlertCard(styles, Alert{Event: AlertFollow, User: "alice"}); ok {
+		t.Errorf("alert without style")
+	}
+	if _, ok := sut.buildAlertCard(styles, Alert{Event: AlertCheer, User: "alice", Amount: 99}); ok {
+		t.Errorf("alert under MIN_AMOUNT")
+	}
+	card, ok := sut.buildAlertCard(styles, Alert{Event: AlertCheer, Amount: 100})
+	if !ok {
+		t.Fatalf("no alert")
+	}
+	if card.Text != AlertAnonymousName+" 100 bits" || card.Seconds != 3 {
+		t.Errorf("invalid card [%v]", card)
+	}
+	if !strings.HasPrefix(card.Image, "/media/") || card.Sound != "https://example.com/cheer.mp3" {
+		t.Errorf("invalid media [%v] [%v]", card.Image, card.Sound)
+	}
+
+	card, _ = sut.buildAlertCard(styles, Alert{Event: AlertReSub, User: "bob", Months: 12})
+	bin, _ := json.Marshal(card)
+	for _, want := range []string{`"event":"resub"`, `"user":"bob"`, `"months":12`, `"text":"bob 12"`, `"seconds":5`} {
+		if !strings.Contains(string(bin), want) {
+			t.Errorf("[%v] not in [%s]", want, bin)
+		}
+	}
+}
+
+func TestDefaultAlertStyles(t *testing.T) {
+	for _, e := range []string{AlertFollow, AlertSub, AlertReSub, AlertGift, AlertCheer, AlertRaid, AlertRedemption} {
+		style, exists := findAlertStyle(DefaultAlertStyles, e)
+		if !exists {
+			t.Errorf("no default style for [%v]", e)
+			continue
+		}
+		if text := renderAlertText(style.Text, &Alert{Event: e, User: "alice"}); !strings.Contains(text, "alice") {
+			t.Errorf("invalid default text [%v]", text)
+		}
+	}
+}
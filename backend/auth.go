@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
 	"time"
 )
 
@@ -82,7 +83,7 @@ func ConfirmAccessToken(cfg *Config) (int, error) {
 			return 0, e
 		}
 	}
-	valid, expires, name, id, err := ValidateAccessToken(cfg)
+	valid, expires, name, id, scopes, err := ValidateAccessToken(cfg)
 	if err != nil {
 		logger.Error("ConfirmUserAccessToken", slog.Any("ERR", err.Error()))
 		return 0, err
@@ -91,28 +92,58 @@ func ConfirmAccessToken(cfg *Config) (int, error) {
 	if valid {
 		cfg.TargetUserId = id
 		cfg.TargetUser = name
+	} else {
+		logger.Info("ConfirmUserAccessToken", slog.Any("msg", "start token refresh"))
+		a, r, err := RefreshAccessToken(cfg, cfg.RefreshToken())
+		if err != nil {
+			logger.Error("ConfirmUserAccessToken : RefreshAccessToken", slog.Any("ERR", err.Error()))
+			return 0, err
+		}
+
+		expires, err = UpdateSavedRefreshToken(cfg, a, r)
+		if err != nil {
+			logger.Error("ConfirmUserAccessToken : UpdateSavedRefreshToken", slog.Any("ERR", err.Error()))
+			return 0, err
+		}
+		if _, _, _, _, scopes, err = ValidateAccessToken(cfg); err != nil {
+			logger.Error("ConfirmUserAccessToken", slog.Any("ERR", err.Error()))
+			return 0, err
+		}
+	}
+
+	// 後から増やしたスコープはトークンを更新しても付かないので、認証からやり直す
+	missing := missingScopes(scopes, EventSubScope)
+	if len(missing) == 0 {
 		logger.Info("ConfirmUserAccessToken", slog.Any("msg", "ok"), slog.Any("expired", expires))
 		return expires, nil
 	}
-
-	logger.Info("ConfirmUserAccessToken", slog.Any("msg", "start token refresh"))
-	a, r, err := RefreshAccessToken(cfg, cfg.RefreshToken())
-	if err != nil {
-		logger.Error("ConfirmUserAccessToken : RefreshAccessToken", slog.Any("ERR", err.Error()))
-		return 0, err
+	logger.Info("ConfirmAccessToken", slog.Any("msg", "scope missing. try to 1st auth"), slog.Any("missing", missing))
+	statsLogger.Info("1stAuth", slog.Any(LogFieldName_Type, "1stAuth"), slog.Any("msg", "scope missing. try to 1st auth"))
+	if e := Issue1stTimeAuthentication(cfg); e != nil {
+		return 0, e
 	}
-
-	expires, err = UpdateSavedRefreshToken(cfg, a, r)
+	_, expires, _, _, _, err = ValidateAccessToken(cfg)
 	if err != nil {
-		logger.Error("ConfirmUserAccessToken : UpdateSavedRefreshToken", slog.Any("ERR", err.Error()))
+		logger.Error("ConfirmUserAccessToken", slog.Any("ERR", err.Error()))
 		return 0, err
 	}
 	return expires, nil
 }
 
+// required のうちトークンに付いていないスコープを返す
+func missingScopes(granted, required []string) []string {
+	ret := []string{}
+	for _, s := range required {
+		if !slices.Contains(granted, s) {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
 func UpdateSavedRefreshToken(cfg *Config, authCode string, refreshToken string) (int, error) {
 	cfg.UpdatAccessToken(AuthEntry{AuthCode: authCode, RefreshToken: refreshToken})
-	valid, expires, name, id, err := ValidateAccessToken(cfg)
+	valid, expires, name, id, _, err := ValidateAccessToken(cfg)
 	if err != nil {
 		logger.Error("UpdateSavedRefreshToken", slog.Any("ERR", err.Error()))
 		return 0, err
@@ -0,0 +1,19 @@
+package backend
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMissingScopes(t *testing.T) {
+	// 報酬の管理を足す前に作ったトークン
+	granted := slices.DeleteFunc(slices.Clone(EventSubScope), func(s string) bool {
+		return s == "channel:manage:redemptions"
+	})
+	if ret := missingScopes(granted, EventSubScope); !slices.Equal(ret, []string{"channel:manage:redemptions"}) {
+		t.Errorf("invalid missing scopes [%v]", ret)
+	}
+	if ret := missingScopes(append(granted, "channel:manage:redemptions", "chat:read"), EventSubScope); len(ret) != 0 {
+		t.Errorf("scopes reported missing [%v]", ret)
+	}
+}
@@ -0,0 +1,169 @@
+package backend
+
+import (
+	_ "embed"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	ChatOverlayEvent          = "chat"
+	ChatOverlayDeleteEvent    = "chat_delete"
+	ChatOverlayClearEvent     = "chat_clear"
+	ChatOverlayClearUserEvent = "chat_clear_user"
+
+	ChatEffectGigantified = "gigantified"
+	ChatEffectMessage     = "message_effect"
+	ChatEffectHighlighted = "highlighted"
+)
+
+// オーバーレイに送る1メッセージ分
+type ChatOverlayMessage struct {
+	Id        string                `json:"id"`
+	User      string                `json:"user"`
+	Login     string                `json:"login"`
+	Color     string                `json:"color"`
+	Badges    []string              `json:"badges"` // 画像のURL
+	Fragments []ChatOverlayFragment `json:"fragments"`
+	Mentioned bool                  `json:"mentioned"` // 配信者宛てのメンションを含む
+	Effect    string                `json:"effect"`
+}
+
+type ChatOverlayFragment struct {
+	Type    string `json:"type"` // text / emote / mention / cheermote
+	Text    string `json:"text"`
+	Image   string `json:"image"`   // emote のとき
+	Giant   bool   `json:"giant"`   // 巨大化スタンプ
+	Mention bool   `json:"mention"` // 配信者宛てのメンション
+}
+
+// __MAX_LINES__ と __FADE_SECONDS__ は配信時に設定値に置き換える
+//
+//go:embed overlay/chat.html
+var ChatHtml string
+
+func buildEmoteUrl(id string, format []string) string {
+	f := "static"
+	if slices.Contains(format, "animated") {
+		f = "animated"
+	}
+	return fmt.Sprintf("https://static-cdn.jtvnw.net/emoticons/v2/%v/%v/dark/2.0", id, f)
+}
+
+// badge は set_id と id からバッジ画像のURLを返す(分からなければ空)
+func buildChatOverlayMessage(e *EventFormatChatMessage, badge func(setId, id string) string) *ChatOverlayMessage {
+	m := &ChatOverlayMessage{
+		Id:        e.MessageId,
+		User:      e.ChatterUserName,
+		Login:     e.ChatterUserLogin,
+		Color:     e.Color,
+		Badges:    []string{},
+		Fragments: []ChatOverlayFragment{},
+	}
+	for _, b := range e.Badges {
+		if url := badge(b.SetId, b.Id); url != "" {
+			m.Badges = append(m.Badges, url)
+		}
+	}
+	switch e.MessageType {
+	case "power_ups_gigantified_emote":
+		m.Effect = ChatEffectGigantified
+	case "power_ups_message_effect":
+		m.Effect = ChatEffectMessage
+	case "channel_points_highlighted":
+		m.Effect = ChatEffectHighlighted
+	}
+	giant := -1
+	for _, f := range e.Message.Fragments {
+		frag := ChatOverlayFragment{Type: f.Type, Text: f.Text}
+		switch f.Type {
+		case "emote":
+			frag.Image = buildEmoteUrl(f.Emote.Id, f.Emote.Format)
+			giant = len(m.Fragments)
+		case "mention":
+			frag.Mention = f.Mention.UserId == e.BroadcasterUserId
+			m.Mentioned = m.Mentioned || frag.Mention
+		}
+		m.Fragments = append(m.Fragments, frag)
+	}
+	// 巨大化されるのはメッセージの最後のスタンプ
+	if m.Effect == ChatEffectGigantified && giant >= 0 {
+		m.Fragments[giant].Giant = true
+	}
+	return m
+}
+
+// バッジ画像のURLを覚えておく
+// 取得に失敗したときも ChatBadgeRefreshInterval までは取り直さない
+type ChatBadges struct {
+	mu       sync.Mutex
+	urls     map[string]string // set_id/id -> URL
+	loadedAt time.Time
+	Load     func() (map[string]string, error)
+}
+
+func NewChatBadges(cfg *Config) *ChatBadges {
+	return &ChatBadges{
+		urls: map[string]string{},
+		Load: func() (map[string]string, error) {
+			return loadChatBadges(cfg)
+		},
+	}
+}
+
+// チャンネルのバッジ(サブスクなど)でグローバルのものを上書きする
+func loadChatBadges(cfg *Config) (map[string]string, error) {
+	ret := map[string]string{}
+	for _, userId := range []string{"", cfg.TargetUserId} {
+		r, err := ReferChatBadges(cfg, userId)
+		if err != nil {
+			return nil, err
+		}
+		for _, set := range r.Data {
+			for _, v := range set.Versions {
+				ret[set.SetId+"/"+v.Id] = v.ImageUrl2x
+			}
+		}
+	}
+	return ret, nil
+}
+
+func (b *ChatBadges) Lookup(setId, id string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if time.Since(b.loadedAt) > ChatBadgeRefreshInterval {
+		b.loadedAt = time.Now()
+		urls, err := b.Load()
+		if err != nil {
+			logger.Error("ChatBadges::Load", slog.Any("ERR", err.Error()))
+		} else {
+			b.urls = urls
+		}
+	}
+	return b.urls[setId+"/"+id]
+}
+
+// ハンドラから呼ばれる。オーバーレイが開かれていなくても待たない
+func (c *BackendContext) PushChat(e *EventFormatChatMessage) {
+	badge := func(string, string) string { return "" }
+	if c.ChatBadges != nil {
+		badge = c.ChatBadges.Lookup
+	}
+	c.Overlay.Hub.Publish(ChatOverlayEvent, buildChatOverlayMessage(e, badge))
+}
+
+func (c *BackendContext) DeleteChat(messageId string) {
+	c.Overlay.Hub.Publish(ChatOverlayDeleteEvent, map[string]string{"id": messageId})
+}
+
+// login が空なら全部消す
+func (c *BackendContext) ClearChat(login string) {
+	if login == "" {
+		c.Overlay.Hub.Publish(ChatOverlayClearEvent, struct{}{})
+		return
+	}
+	c.Overlay.Hub.Publish(ChatOverlayClearUserEvent, map[string]string{"login": login})
+}
@@ -0,0 +1,88 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func TestBuildChatOverlayMessage(t *testing.T) {
+	raw := `{
+		"broadcaster_user_id": "100",
+		"chatter_user_login": "alice",
+		"chatter_user_name": "Alice",
+		"message_id": "m1",
+		"color": "#FF0000",
+		"message_type": "power_ups_gigantified_emote",
+		"badges": [{"set_id": "subscriber", "id": "3"}, {"set_id": "unknown", "id": "1"}],
+		"message": {
+			"text": "@Streamer hi Kappa PogChamp",
+			"fragments": [
+				{"type": "mention", "text": "@Streamer", "mention": {"user_id": "100"}},
+				{"type": "mention", "text": "@bob", "mention": {"user_id": "200"}},
+				{"type": "text", "text": " hi "},
+				{"type": "emote", "text": "Kappa", "emote": {"id": "25", "format": ["static"]}},
+				{"type": "emote", "text": "PogChamp", "emote": {"id": "305954156", "format": ["static", "animated"]}}
+			]
+		}
+	}`
+	e := &EventFormatChatMessage{}
+	if err := json.Unmarshal([]byte(raw), e); err != nil {
+		t.Fatal(err)
+	}
+	badge := func(setId, id string) string {
+		if setId == "subscriber" {
+			return "https://example.com/" + setId + "/" + id
+		}
+		return ""
+	}
+
+	m := buildChatOverlayMessage(e, badge)
+	if m.Id != "m1" || m.User != "Alice" || m.Login != "alice" || m.Color != "#FF0000" {
+		t.Errorf("invalid message [%v]", m)
+	}
+	if len(m.Badges) != 1 || m.Badges[0] != "https://example.com/subscriber/3" {
+		t.Errorf("invalid badges [%v]", m.Badges)
+	}
+	if !m.Mentioned || !m.Fragments[0].Mention || m.Fragments[1].Mention {
+		t.Errorf("invalid mention [%v]", m.Fragments)
+	}
+	if m.Fragments[3].Image != "https://static-cdn.jtvnw.net/emoticons/v2/25/static/dark/2.0" || m.Fragments[3].Giant {
+		t.Errorf("invalid emote [%v]", m.Fragments[3])
+	}
+	if m.Fragments[4].Image != "https://static-cdn.jtvnw.net/emoticons/v2/305954156/animated/dark/2.0" || !m.Fragments[4].Giant {
+		t.Errorf("invalid gigantified emote [%v]", m.Fragments[4])
+	}
+	if m.Effect != ChatEffectGigantified {
+		t.Errorf("invalid effect [%v]", m.Effect)
+	}
+}
+
+func TestChatBadges(t *testing.T) {
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	sut := &ChatBadges{urls: map[string]string{}}
+	count := 0
+	sut.Load = func() (map[string]string, error) {
+		count++
+		return nil, errors.New("failed")
+	}
+	// 失敗してもしばらくは取り直さない
+	if url := sut.Lookup("subscriber", "0"); url != "" || count != 1 {
+		t.Errorf("invalid lookup [%v] [%v]", url, count)
+	}
+	sut.Lookup("subscriber", "0")
+	if count != 1 {
+		t.Errorf("reloaded [%v]", count)
+	}
+
+	sut.loadedAt = sut.loadedAt.Add(-ChatBadgeRefreshInterval * 2)
+	sut.Load = func() (map[string]string, error) {
+		count++
+		return map[string]string{"subscriber/0": "https://example.com/sub0"}, nil
+	}
+	if url := sut.Lookup("subscriber", "0"); url != "https://example.com/sub0" || count != 2 {
+		t.Errorf("invalid lookup [%v] [%v]", url, count)
+	}
+}
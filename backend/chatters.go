@@ -0,0 +1,50 @@
+package backend
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// 過去の配信でチャットしたことのあるユーザ(login名)の一覧
+// 初チャットの判定に使う
+type KnownChatters struct {
+	Path  string
+	Users map[string]struct{}
+}
+
+func LoadKnownChatters(path string) *KnownChatters {
+	ret := &KnownChatters{Path: path, Users: map[string]struct{}{}}
+	f, err := os.Open(path)
+	if err != nil {
+		return ret
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		login := strings.TrimSpace(scanner.Text())
+		if login == "" {
+			continue
+		}
+		ret.Users[login] = struct{}{}
+	}
+	return ret
+}
+
+// 初めて見たユーザならファイルへ追記して true を返す
+func (k *KnownChatters) Add(login string) bool {
+	if _, exists := k.Users[login]; exists {
+		return false
+	}
+	k.Users[login] = struct{}{}
+	f, err := os.OpenFile(k.Path, os.O_APPEND|os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		logger.Error("KnownChatters::Add", slog.Any("ERR", err.Error()))
+		return true
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "%v\n", login)
+	return true
+}
@@ -0,0 +1,141 @@
+package backend
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// 配信中の統計を定期的にファイルへ書き出しておき、
+// アプリの終了やクラッシュで配信履歴が失われないようにする
+type StatsCheckpoint struct {
+	SavedAt time.Time
+	Stats   *TwitchStats
+}
+
+// 配信終了時の破棄と定期保存が前後しないようにする
+var checkpointLock sync.Mutex
+
+func SaveStatsCheckpoint(path string, s *TwitchStats) error {
+	body, err := json.Marshal(&StatsCheckpoint{SavedAt: time.Now(), Stats: s.Snapshot()})
+	if err != nil {
+		return err
+	}
+	// 書き込み途中で落ちても前回分が壊れないように置き換える
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, body, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func LoadStatsCheckpoint(path string) (*StatsCheckpoint, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ret := &StatsCheckpoint{Stats: NewTwitchStats()}
+	if err := json.Unmarshal(raw, ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func DiscardStatsCheckpoint(cfg *Config) {
+	checkpointLock.Lock()
+	defer checkpointLock.Unlock()
+	if err := os.Remove(cfg.StatsCheckpointFullPath()); err != nil && !os.IsNotExist(err) {
+		logger.Error("DiscardStatsCheckpoint", slog.Any("ERR", err.Error()))
+	}
+}
+
+// テストで差し替える
+var referStreamStartedAt = ReferStreamStartedAt
+
+// 配信の開始日時を取れるまで何度か試す
+func referStreamStartedAtWithRetry(cfg *Config) (time.Time, error) {
+	var err error
+	for i := 0; i < StatsRestoreRetry; i++ {
+		if i > 0 {
+			time.Sleep(StatsRestoreRetryWait)
+		}
+		var started time.Time
+		if started, err = referStreamStartedAt(cfg, cfg.TargetUserId); err == nil {
+			return started, nil
+		}
+		logger.Error("RestoreStatsCheckpoint", slog.Any("msg", "ReferStreamStartedAt"), slog.Any("retry", i), slog.Any("ERR", err.Error()))
+	}
+	return time.Time{}, err
+}
+
+// 今の配信が前回の統計と同じ配信か
+// 統計の開始日時は stream.online を受けた(または起動した)時刻なので、配信の開始日時より少し後になる
+func isSameStream(c *StatsCheckpoint, started time.Time) bool {
+	if started.IsZero() {
+		return false
+	}
+	return !started.After(c.Stats.LastPeriod.Started.Add(StatsRestoreTolerance))
+}
+
+// 起動時に前回のチェックポイントが残っていれば
+//   - 同じ配信がまだ続いていれば統計を引き継ぐ
+//   - 配信が終わっているか別の配信が始まっていれば、最後に保存した時点までの内容で配信履歴を書き出す
+//
+// 配信の状態が分からないときも書き出しておく(残したままだと次の保存で上書きされて失われる)
+func RestoreStatsCheckpoint(cfg *Config, s *TwitchStats) {
+	c, err := LoadStatsCheckpoint(cfg.StatsCheckpointFullPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Error("RestoreStatsCheckpoint", slog.Any("msg", "load error"), slog.Any("ERR", err.Error()))
+		}
+		return
+	}
+	started, err := referStreamStartedAtWithRetry(cfg)
+	if err == nil && isSameStream(c, started) {
+		s.Restore(c.Stats)
+		statsLogger.Info("RestoreStats",
+			slog.Any(LogFieldName_Type, "統計復元"),
+			slog.Any("started", c.Stats.LastPeriod.Started),
+			slog.Any("saved", c.SavedAt),
+		)
+		return
+	}
+	c.Stats.LastPeriod.Finished = c.SavedAt
+	writeStreamSummary(cfg, c.Stats)
+	DiscardStatsCheckpoint(cfg)
+	statsLogger.Info("RestoreStats",
+		slog.Any(LogFieldName_Type, "統計書き出し(前回分)"),
+		slog.Any("started", c.Stats.LastPeriod.Started),
+		slog.Any("saved", c.SavedAt),
+		slog.Any("current", started),
+	)
+}
+
+// 配信中のときだけ保存する
+func CheckpointStats(cfg *Config, s *TwitchStats) {
+	checkpointLock.Lock()
+	defer checkpointLock.Unlock()
+	if !s.IsStreaming() {
+		return
+	}
+	if err := SaveStatsCheckpoint(cfg.StatsCheckpointFullPath(), s); err != nil {
+		logger.Error("CheckpointStats", slog.Any("ERR", err.Error()))
+	}
+}
+
+func StartStatsCheckpoint(cfg *Config, s *TwitchStats, done chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(time.Second * StatsCheckpointSecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				CheckpointStats(cfg, s)
+			}
+		}
+	}()
+}
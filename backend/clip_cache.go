@@ -0,0 +1,183 @@
+package backend
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// CDNのmp4は再生の出だしで止まることがあるので、レイド元のクリップは先にダウンロードしておく
+// ダウンロードが終わっていないクリップはこれまでどおりCDNから再生する
+type ClipCache struct {
+	Config  *Config
+	Client  *http.Client
+	mu      sync.Mutex
+	pending map[string]bool // ダウンロード中のURL
+}
+
+const (
+	clipCacheExt     = ".mp4"
+	clipCachePartExt = ".part"
+)
+
+func NewClipCache(cfg *Config) *ClipCache {
+	return &ClipCache{
+		Config:  cfg,
+		Client:  &http.Client{Timeout: ClipDownloadTimeout},
+		pending: map[string]bool{},
+	}
+}
+
+func (c *ClipCache) dir() string {
+	if c == nil || c.Config == nil {
+		return ""
+	}
+	return c.Config.ClipCacheDir()
+}
+
+func clipCacheFile(dir, url string) string {
+	return filepath.Join(dir, fmt.Sprintf("%x%v", sha1.Sum([]byte(url)), clipCacheExt))
+}
+
+// ダウンロード済みならローカルのパスを返す。無ければ空文字
+func (c *ClipCache) Lookup(url string) string {
+	dir := c.dir()
+	if dir == "" || url == "" {
+		return ""
+	}
+	c.mu.Lock()
+	pending := c.pending[url]
+	c.mu.Unlock()
+	if pending {
+		return ""
+	}
+	path := clipCacheFile(dir, url)
+	if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+		return ""
+	}
+	return path
+}
+
+// 裏でダウンロードする。済んでいるものとダウンロード中のものは飛ばす
+func (c *ClipCache) Prefetch(clips []UserClip) {
+	urls := c.reserve(clips)
+	if len(urls) == 0 {
+		return
+	}
+	go c.fetch(urls)
+}
+
+func (c *ClipCache) reserve(clips []UserClip) []string {
+	dir := c.dir()
+	if dir == "" {
+		return nil
+	}
+	ret := []string{}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, clip := range clips {
+		if clip.Mp4 == "" || c.pending[clip.Mp4] {
+			continue
+		}
+		if _, err := os.Stat(clipCacheFile(dir, clip.Mp4)); err == nil {
+			continue
+		}
+		c.pending[clip.Mp4] = true
+		ret = append(ret, clip.Mp4)
+	}
+	return ret
+}
+
+func (c *ClipCache) fetch(urls []string) {
+	dir := c.dir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		logger.Error("ClipCache::MkdirAll", slog.Any("dir", dir), slog.Any("ERR", err.Error()))
+	}
+	for _, url := range urls {
+		if err := c.download(dir, url); err != nil {
+			logger.Error("ClipCache::Download", slog.Any("url", url), slog.Any("ERR", err.Error()))
+		} else {
+			logger.Info("ClipCache:Downloaded", slog.Any("url", url))
+		}
+		c.mu.Lock()
+		delete(c.pending, url)
+		c.mu.Unlock()
+	}
+	if err := pruneClipCache(dir, c.Config.ClipCacheMaxBytes(), c.Config.ClipCacheMaxAge(), time.Now()); err != nil {
+		logger.Error("ClipCache::Prune", slog.Any("dir", dir), slog.Any("ERR", err.Error()))
+	}
+}
+
+// 途中のファイルを再生しないよう、書き終わってから名前を変える
+func (c *ClipCache) download(dir, url string) error {
+	res, err := c.Client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("status [%v]", res.Status)
+	}
+	tmp, err := os.CreateTemp(dir, "*"+clipCachePartExt)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, res.Body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), clipCacheFile(dir, url))
+}
+
+// maxAge より古いものを消し、合計が maxBytes を超えていれば古い順に消す
+// 0以下の制限は使わない
+func pruneClipCache(dir string, maxBytes int64, maxAge time.Duration, now time.Time) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	files := []os.FileInfo{}
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if e.IsDir() || (ext != clipCacheExt && ext != clipCachePartExt) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		// 書きかけのファイルは古くなったものだけ消す
+		if maxAge > 0 && now.Sub(info.ModTime()) > maxAge {
+			os.Remove(filepath.Join(dir, e.Name()))
+			continue
+		}
+		if ext == clipCacheExt {
+			files = append(files, info)
+		}
+	}
+	if maxBytes <= 0 {
+		return nil
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().After(files[j].ModTime())
+	})
+	total := int64(0)
+	for _, f := range files {
+		total += f.Size()
+		if total > maxBytes {
+			os.Remove(filepath.Join(dir, f.Name()))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package backend
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClipCache(t *testing.T) {
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/a.mp4" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("clip body"))
+	}))
+	defer server.Close()
+	cfg := &Config{}
+	cfg.Init()
+	cfg.Body.ClipCacheDirectory = t.TempDir()
+	sut := NewOverlay(cfg)
+	remote := server.URL + "/a.mp4"
+	clips := []UserClip{{Id: "clip1", Mp4: remote}, {Mp4: server.URL + "/missing.mp4"}}
+
+	if path := sut.ClipCache.Lookup(remote); path != "" {
+		t.Fatalf("found before download [%v]", path)
+	}
+	urls := sut.ClipCache.reserve(clips)
+	if len(urls) != 2 || sut.ClipCache.Lookup(remote) != "" {
+		t.Fatalf("invalid reserve [%v]", urls)
+	}
+	// ダウンロード中のものは重ねて取りにいかない
+	if again := sut.ClipCache.reserve(clips); len(again) != 0 {
+		t.Errorf("reserved twice [%v]", again)
+	}
+	sut.ClipCache.fetch(urls)
+	path := sut.ClipCache.Lookup(remote)
+	if b, err := os.ReadFile(path); err != nil || string(b) != "clip body" {
+		t.Fatalf("not cached [%v] [%v]", path, err)
+	}
+	if p := sut.ClipCache.Lookup(server.URL + "/missing.mp4"); p != "" {
+		t.Errorf("failed download cached [%v]", p)
+	}
+	if parts, _ := filepath.Glob(filepath.Join(cfg.ClipCacheDir(), "*"+clipCachePartExt)); len(parts) != 0 {
+		t.Errorf("part files left [%v]", parts)
+	}
+
+	// ローカルのファイル -> CDNのmp4 -> 埋め込み の順に切り替える
+	all, _ := sut.Hub.Subscribe(nil, 0)
+	sut.StartUserClip(&clips[0])
+	m := <-all.ch
+	s := sut.Playback()
+	if !strings.HasPrefix(s.Src, "/media/") || s.Origin != remote || !strings.Contains(string(m.Data), s.Src) {
+		t.Fatalf("cached clip not used [%v] [%s]", s, m.Data)
+	}
+	sut.ReportPlayback(&PlaybackReport{State: PlaybackError, Src: s.Src, Reason: "decode"})
+	m = <-all.ch
+	if s := sut.Playback(); s.State != PlaybackFallback || s.Src != remote || !strings.Contains(string(m.Data), `"player":"video"`) {
+		t.Errorf("no fallback to remote [%v] [%s]", s, m.Data)
+	}
+	sut.ReportPlayback(&PlaybackReport{State: PlaybackError, Src: remote, Reason: "network"})
+	m = <-all.ch
+	if s := sut.Playback(); s.State != PlaybackFallback || s.Origin != remote || !strings.Contains(string(m.Data), `"player":"embed"`) {
+		t.Errorf("no fallback to embed [%v] [%s]", s, m.Data)
+	}
+
+	cfg.Body.ClipCacheDirectory = ""
+	if p := sut.ClipCache.Lookup(remote); p != "" {
+		t.Errorf("cache used while disabled [%v]", p)
+	}
+}
+
+func TestPruneClipCache(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	write := func(name string, size int, age time.Duration) {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, make([]byte, size), 0644)
+		os.Chtimes(path, now.Add(-age), now.Add(-age))
+	}
+	write("new.mp4", 40, time.Minute)
+	write("mid.mp4", 40, time.Hour)
+	write("old.mp4", 40, 2*time.Hour)
+	write("expired.mp4", 10, 48*time.Hour)
+	write("stale.part", 10, 48*time.Hour)
+	write("writing.part", 10, time.Minute)
+	write("other.txt", 10, 48*time.Hour)
+
+	if err := pruneClipCache(dir, 100, 24*time.Hour, now); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{
+		"new.mp4": true, "mid.mp4": true, "old.mp4": false, "expired.mp4": false,
+		"stale.part": false, "writing.part": true, "other.txt": true,
+	} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if (err == nil) != want {
+			t.Errorf("%v exists [%v] want [%v]", name, err == nil, want)
+		}
+	}
+}
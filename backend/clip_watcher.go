@@ -17,12 +17,17 @@ import (
 )
 
 func playSound(path string) {
+	playSoundFile(path)
+}
+
+// 再生が終わるまで戻らない
+func playSoundFile(path string) error {
 	f, err := os.Open(path)
-	defer f.Close()
 	if err != nil {
 		logger.Error("PlaySound(open)", slog.Any("error", err.Error()))
-		return
+		return err
 	}
+	defer f.Close()
 
 	var streamer beep.StreamSeekCloser
 	var format beep.Format
@@ -36,16 +41,20 @@ func playSound(path string) {
 	}
 	if err != nil {
 		logger.Error("PlaySound(Decode)", slog.Any("error", err.Error()))
-		return
+		return err
 	}
 	defer streamer.Close()
 
-	speaker.Init(format.SampleRate, format.SampleRate.N(time.Second/10))
+	if err := speaker.Init(format.SampleRate, format.SampleRate.N(time.Second/10)); err != nil {
+		logger.Error("PlaySound(Init)", slog.Any("error", err.Error()))
+		return err
+	}
 	done := make(chan bool)
 	speaker.Play(beep.Seq(streamer, beep.Callback(func() {
 		done <- true
 	})))
 	<-done
+	return nil
 }
 
 func showNotification(user, url, at string) {
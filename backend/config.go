@@ -2,30 +2,54 @@ package backend
 
 import (
 	"io"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 type ConfigBody struct {
-	ChatTargets                []string `yaml:"CHART_TARGETS"`
-	NotifySoundFile            string   `yaml:"NOTIFY_SOUND"`
-	DebugMode                  bool     `yaml:"DEBUG"`
-	LocalTest                  bool     `yaml:"LOCAL_TEST"`
-	LogDest                    string   `yaml:"LOG_DEST"`
-	ObsIp                      string   `yaml:"OBS_IP"`
-	ObsPort                    int      `yaml:"OBS_PORT"`
-	ObsPass                    string   `yaml:"OBS_PASS"`
-	StopStreamAfterRaided      bool     `yaml:"STOP_STREAM_AFTER_RAID"`
-	DelaySecondsFromRaidToStop int      `yaml:"DELAY_TO_STOP"`
-	NewClipWatchIntervalSecond int      `yaml:"NEW_CLIP_INTERVAL"`
-	LocalServerPortNumber      int      `yaml:"SERVER_PORT"`
-	OverlayEnabled             bool     `yaml:"OVERLAY_ENABLE"`
-	ClipPlayerWidth            int      `yaml:"CLIP_PLAYER_WIDTH"`
-	ClipPlayerHeight           int      `yaml:"CLIP_PLAYER_HEIGHT"`
-	LogTopIndent               string   `yaml:"LOG_TOP_INDENT"`
-	LogUserNamePrefix          string   `yaml:"LOG_USER_NAME_PREFIX"`
+	ChatTargets                []string          `yaml:"CHART_TARGETS"`
+	NotifySoundFile            string            `yaml:"NOTIFY_SOUND"`
+	DebugMode                  bool              `yaml:"DEBUG"`
+	LocalTest                  bool              `yaml:"LOCAL_TEST"`
+	LogDest                    string            `yaml:"LOG_DEST"`
+	ObsIp                      string            `yaml:"OBS_IP"`
+	ObsPort                    int               `yaml:"OBS_PORT"`
+	ObsPass                    string            `yaml:"OBS_PASS"`
+	StopStreamAfterRaided      bool              `yaml:"STOP_STREAM_AFTER_RAID"`
+	DelaySecondsFromRaidToStop int               `yaml:"DELAY_TO_STOP"`
+	NewClipWatchIntervalSecond int               `yaml:"NEW_CLIP_INTERVAL"`
+	LocalServerPortNumber      int               `yaml:"SERVER_PORT"`
+	ServerBindAddress          string            `yaml:"SERVER_BIND"`
+	OverlayAccessToken         string            `yaml:"OVERLAY_TOKEN"`
+	ControlAllowedOrigins      []string          `yaml:"CONTROL_ALLOWED_ORIGINS"`
+	OverlayEnabled             bool              `yaml:"OVERLAY_ENABLE"`
+	OverlayDirectory           string            `yaml:"OVERLAY_DIR"`
+	ClipPlayerWidth            int               `yaml:"CLIP_PLAYER_WIDTH"`
+	ClipPlayerHeight           int               `yaml:"CLIP_PLAYER_HEIGHT"`
+	ClipGapSeconds             int               `yaml:"CLIP_GAP_SECONDS"`
+	ClipCacheDirectory         string            `yaml:"CLIP_CACHE_DIR"`
+	ClipCacheMaxMegaBytes      int               `yaml:"CLIP_CACHE_MAX_MB"`
+	ClipCacheMaxHours          int               `yaml:"CLIP_CACHE_MAX_HOURS"`
+	ChatOverlayMaxLines        int               `yaml:"CHAT_OVERLAY_MAX_LINES"`
+	ChatOverlayFadeSeconds     int               `yaml:"CHAT_OVERLAY_FADE_SECONDS"`
+	SubGoalPoints              int               `yaml:"SUB_GOAL"`
+	ControlApiToken            string            `yaml:"CONTROL_TOKEN"`
+	HistoryRetentionDays       int               `yaml:"HISTORY_RETENTION_DAYS"`
+	LogTopIndent               string            `yaml:"LOG_TOP_INDENT"`
+	LogUserNamePrefix          string            `yaml:"LOG_USER_NAME_PREFIX"`
+	SummaryTemplateFile        string            `yaml:"SUMMARY_TEMPLATE"`
+	SummaryOrder               string            `yaml:"SUMMARY_ORDER"`
+	SummarySectionOrder        map[string]string `yaml:"SUMMARY_SECTION_ORDER"`
+	RewardSetList              []RewardSet       `yaml:"REWARD_SETS"`
+	RewardActionList           []RewardAction    `yaml:"REWARD_ACTIONS"`
+	RuleList                   []Rule            `yaml:"RULES"`
+	RulesDryRun                bool              `yaml:"RULES_DRY_RUN"`
+	AlertList                  []AlertStyle      `yaml:"ALERTS"`
 }
 
 type AuthEntry struct {
@@ -42,6 +66,12 @@ type Config struct {
 	TargetUserId    string
 	StatsLogPath    string
 	RaidLogPath     string
+	ChattersPath    string
+	CheckpointPath  string
+	ExportDir       string
+	HistoryPath     string
+	ScriptsDir      string
+	ruleErr         error // RULES の REGEX のエラー
 }
 
 var (
@@ -56,11 +86,35 @@ var (
 		DelaySecondsFromRaidToStop: 180,
 		NewClipWatchIntervalSecond: 128,
 		LocalServerPortNumber:      8930,
+		ServerBindAddress:          OverlayDefaultBind,
+		OverlayAccessToken:         "",
+		ControlAllowedOrigins:      []string{},
 		OverlayEnabled:             true,
+		OverlayDirectory:           OverlayDefaultDir,
 		ClipPlayerWidth:            640,
 		ClipPlayerHeight:           480,
+		ClipGapSeconds:             3,
+		ClipCacheDirectory:         ClipCacheDefaultDir,
+		ClipCacheMaxMegaBytes:      1024,
+		ClipCacheMaxHours:          72,
+		ChatOverlayMaxLines:        15,
+		ChatOverlayFadeSeconds:     0,
+		SubGoalPoints:              10,
+		ControlApiToken:            "",
+		HistoryRetentionDays:       HistoryKeepDays,
 		LogTopIndent:               "  ",
 		LogUserNamePrefix:          "- ",
+		SummaryTemplateFile:        "",
+		SummaryOrder:               SummaryOrderCount,
+		SummarySectionOrder: map[string]string{
+			SummarySectionFollow: SummaryOrderTime,
+			SummarySectionRaid:   SummaryOrderTime,
+		},
+		RewardSetList:    []RewardSet{},
+		RewardActionList: []RewardAction{},
+		RuleList:         []Rule{},
+		RulesDryRun:      false,
+		AlertList:        DefaultAlertStyles,
 	}
 )
 
@@ -70,6 +124,7 @@ func loadConfigFrom(raw []byte) (*Config, error) {
 	if e := yaml.Unmarshal(raw, &ret.Body); e != nil {
 		return nil, e
 	}
+	ret.ruleErr = compileRules(ret.Body.RuleList)
 	return ret, nil
 }
 
@@ -106,8 +161,22 @@ func LoadConfigFromFile(path string) (*Config, error) {
 	return loadConfigFrom(b)
 }
 
+// DefaultConfig をコピーする
+// マップやスライスは共有したままだと読み込んだ値が DefaultConfig に書き込まれるので複製する
+func defaultConfigBody() ConfigBody {
+	b := DefaultConfig
+	b.ChatTargets = slices.Clone(DefaultConfig.ChatTargets)
+	b.ControlAllowedOrigins = slices.Clone(DefaultConfig.ControlAllowedOrigins)
+	b.SummarySectionOrder = maps.Clone(DefaultConfig.SummarySectionOrder)
+	b.RewardSetList = slices.Clone(DefaultConfig.RewardSetList)
+	b.RewardActionList = slices.Clone(DefaultConfig.RewardActionList)
+	b.RuleList = slices.Clone(DefaultConfig.RuleList)
+	b.AlertList = slices.Clone(DefaultConfig.AlertList)
+	return b
+}
+
 func (c *Config) Init() {
-	c.Body = DefaultConfig
+	c.Body = defaultConfigBody()
 	c.Auth = AuthEntry{
 		AuthCode:     "",
 		RefreshToken: "",
@@ -116,6 +185,11 @@ func (c *Config) Init() {
 	c.AppClientSecret = AppClientSecret
 	c.StatsLogPath = StatsLogPath
 	c.RaidLogPath = RaidLogPath
+	c.ChattersPath = KnownChattersPath
+	c.CheckpointPath = StatsCheckpointPath
+	c.ExportDir = StatsExportDir
+	c.HistoryPath = HistoryDbPath
+	c.ScriptsDir = ScriptsDir
 }
 
 func (c *Config) SaveTo(dest string) error {
@@ -182,6 +256,7 @@ func (c *Config) LoadAuthConfig() error {
 
 func (c *Config) UpdateRaw(b *ConfigBody) {
 	c.Body = *b
+	c.ruleErr = compileRules(c.Body.RuleList)
 }
 
 func (c *Config) LoadRaw() *ConfigBody {
@@ -228,6 +303,21 @@ func (c *Config) LocalPortNum() int {
 	return c.Body.LocalServerPortNumber
 }
 
+// 空ならすべてのインターフェースで待ち受ける
+func (c *Config) BindAddress() string {
+	return c.Body.ServerBindAddress
+}
+
+// ブラウザソースのURLに ?token= で付ける。空なら確認しない
+func (c *Config) OverlayToken() string {
+	return c.Body.OverlayAccessToken
+}
+
+// 制御APIを呼んでもよい別のページのOrigin(例: http://localhost:3000)
+func (c *Config) ControlOrigins() []string {
+	return c.Body.ControlAllowedOrigins
+}
+
 func (c *Config) LogPath() string {
 	return c.Body.LogDest
 }
@@ -236,6 +326,27 @@ func (c *Config) StatsLogFullPath() string {
 	return filepath.Join(c.Body.LogDest, c.StatsLogPath)
 }
 
+func (c *Config) KnownChattersFullPath() string {
+	return filepath.Join(c.Body.LogDest, c.ChattersPath)
+}
+
+func (c *Config) StatsCheckpointFullPath() string {
+	return filepath.Join(c.Body.LogDest, c.CheckpointPath)
+}
+
+func (c *Config) StatsExportFullPath() string {
+	return filepath.Join(c.Body.LogDest, c.ExportDir)
+}
+
+func (c *Config) HistoryFullPath() string {
+	return filepath.Join(c.Body.LogDest, c.HistoryPath)
+}
+
+// スクリプトはconfig.yamlと同じ場所に置く
+func (c *Config) ScriptsFullPath() string {
+	return c.ScriptsDir
+}
+
 func (c *Config) StopStreamAfterRaided() bool {
 	return c.Body.StopStreamAfterRaided
 }
@@ -268,6 +379,11 @@ func (c *Config) ObsPass() string {
 	return c.Body.ObsPass
 }
 
+// オーバーレイのページを置くフォルダ。空なら組み込みのページだけ使う
+func (c *Config) OverlayDir() string {
+	return c.Body.OverlayDirectory
+}
+
 func (c *Config) ClipWidth() int {
 	return c.Body.ClipPlayerWidth
 }
@@ -276,6 +392,53 @@ func (c *Config) ClipHeight() int {
 	return c.Body.ClipPlayerHeight
 }
 
+func (c *Config) ClipGap() time.Duration {
+	return time.Duration(c.Body.ClipGapSeconds) * time.Second
+}
+
+// クリップを先にダウンロードしておくフォルダ。空ならダウンロードしない
+func (c *Config) ClipCacheDir() string {
+	return c.Body.ClipCacheDirectory
+}
+
+func (c *Config) ClipCacheMaxBytes() int64 {
+	return int64(c.Body.ClipCacheMaxMegaBytes) * 1024 * 1024
+}
+
+func (c *Config) ClipCacheMaxAge() time.Duration {
+	return time.Duration(c.Body.ClipCacheMaxHours) * time.Hour
+}
+
+func (c *Config) ChatMaxLines() int {
+	return c.Body.ChatOverlayMaxLines
+}
+
+// 0なら消さない
+func (c *Config) ChatFadeSeconds() int {
+	return c.Body.ChatOverlayFadeSeconds
+}
+
+// サブスク目標(サブスクポイント)
+func (c *Config) SubGoal() int {
+	return c.Body.SubGoalPoints
+}
+
+// 制御APIの合言葉。空なら制御APIは使えない
+func (c *Config) ControlToken() string {
+	return c.Body.ControlApiToken
+}
+
+// 配信をまたいだ履歴の通知を残しておく期間。0なら消さない
+// ユーザごと、月ごとの集計は期間を過ぎても残る
+// 月のランキングに使うので1か月より短くはしない
+func (c *Config) HistoryRetention() time.Duration {
+	days := c.Body.HistoryRetentionDays
+	if days > 0 && days < HistoryMinKeepDays {
+		days = HistoryMinKeepDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
 func (c *Config) TopIndent() string {
 	return c.Body.LogTopIndent
 }
@@ -283,3 +446,39 @@ func (c *Config) TopIndent() string {
 func (c *Config) UserNamePrefix() string {
 	return c.Body.LogUserNamePrefix
 }
+
+func (c *Config) SummaryTemplatePath() string {
+	return c.Body.SummaryTemplateFile
+}
+
+func (c *Config) SummaryOrder() SummaryOrder {
+	return SummaryOrder{
+		Default:  c.Body.SummaryOrder,
+		Sections: c.Body.SummarySectionOrder,
+	}
+}
+
+func (c *Config) RewardSets() []RewardSet {
+	return c.Body.RewardSetList
+}
+
+func (c *Config) RewardActions() []RewardAction {
+	return c.Body.RewardActionList
+}
+
+func (c *Config) Rules() []Rule {
+	return c.Body.RuleList
+}
+
+// 読み込み時にコンパイルできなかった REGEX (無ければnil)
+func (c *Config) RuleError() error {
+	return c.ruleErr
+}
+
+func (c *Config) IsRulesDryRun() bool {
+	return c.Body.RulesDryRun
+}
+
+func (c *Config) AlertStyles() []AlertStyle {
+	return c.Body.AlertList
+}
@@ -91,3 +91,32 @@ func TestConfig_DontUpdateSavedData(t *testing.T) {
 	os.Remove(dest)
 	os.Remove(dest2)
 }
+
+func TestConfig_DefaultNotShared(t *testing.T) {
+	raw := []byte(`SUMMARY_SECTION_ORDER:
+  follow: count
+  cheer: name
+ALERTS:
+  - EVENT: follow
+    TEXT: changed
+`)
+	if _, e := loadConfigFrom(raw); e != nil {
+		t.Fatalf("load error [%v]", e.Error())
+	}
+	c, e := loadConfigFrom([]byte(`SERVER_PORT: 1234
+`))
+	if e != nil {
+		t.Fatalf("load error [%v]", e.Error())
+	}
+	order := c.Body.SummarySectionOrder
+	if len(order) != 2 || order[SummarySectionFollow] != SummaryOrderTime {
+		t.Errorf("default section order polluted [%v]", order)
+	}
+	if DefaultConfig.SummarySectionOrder[SummarySectionFollow] != SummaryOrderTime {
+		t.Errorf("DefaultConfig polluted [%v]", DefaultConfig.SummarySectionOrder)
+	}
+	c.Body.AlertList[0].Text = "edited"
+	if DefaultConfig.AlertList[0].Text == "edited" {
+		t.Errorf("DefaultConfig alerts shared")
+	}
+}
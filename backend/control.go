@@ -0,0 +1,328 @@
+package backend
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// Stream Deck などのローカルのツールから操作するためのAPI
+//
+//	POST /api/<command>  本文が引数(JSON)
+//	GET  /api/ws         WebSocket。{"id":"1","command":"clip.stop","args":{}} を送ると同じidで結果が返る
+//
+// どちらも CONTROL_TOKEN を Authorization: Bearer <token> か ?token=<token> で渡す
+// CONTROL_TOKEN が空なら使えない
+type ControlRequest struct {
+	Id      string          `json:"id"`
+	Command string          `json:"command"`
+	Args    json.RawMessage `json:"args"`
+}
+
+type ControlResponse struct {
+	Id     string `json:"id,omitempty"`
+	Ok     bool   `json:"ok"`
+	Result any    `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// WebSocketで接続中に届くオーバーレイのイベント
+type ControlEvent struct {
+	Event string          `json:"event"`
+	Id    uint64          `json:"id"`
+	Data  json.RawMessage `json:"data"`
+}
+
+type ControlFunc func(c *BackendContext, args json.RawMessage) (any, error)
+
+type ControlCommand struct {
+	Func     ControlFunc
+	ReadOnly bool // GETでも呼べる
+}
+
+var (
+	ErrControlDisabled       = errors.New("control api disabled")
+	ErrControlUnauthorized   = errors.New("invalid token")
+	ErrControlUnknownCommand = errors.New("unknown command")
+)
+
+var ControlCommandTable = map[string]ControlCommand{
+	"clip.play":      {controlClipPlay, false},
+	"clip.stop":      {controlClipStop, false},
+	"clip.queue":     {controlClipQueue, false},
+	"playlist":       {controlPlaylist, true},
+	"playlist.next":  {controlPlaylistNext, false},
+	"playlist.prev":  {controlPlaylistPrev, false},
+	"playlist.skip":  {controlPlaylistSkip, false},
+	"playlist.clear": {controlPlaylistClear, false},
+	"alert.test":     {controlAlertTest, false},
+	"alert.replay":   {controlAlertReplay, false},
+	"obs.scene":      {controlObsScene, false},
+	"stats":          {controlStats, true},
+	"subscriptions":  {controlSubscriptions, true},
+}
+
+// 引数が無ければそのまま
+func parseControlArgs(args json.RawMessage, v any) error {
+	if len(args) == 0 || string(args) == "null" {
+		return nil
+	}
+	return json.Unmarshal(args, v)
+}
+
+func controlClipPlay(c *BackendContext, args json.RawMessage) (any, error) {
+	v := struct {
+		Url string `json:"url"`
+		Id  string `json:"id"` // 分かれば再生できなかったときに埋め込みで流し直す
+	}{}
+	if err := parseControlArgs(args, &v); err != nil {
+		return nil, err
+	}
+	if v.Url == "" {
+		return nil, errors.New("url is required")
+	}
+	n := c.Overlay.StartUserClip(&UserClip{Id: v.Id, Mp4: v.Url})
+	return map[string]int{"clients": n}, nil
+}
+
+func controlClipStop(c *BackendContext, _ json.RawMessage) (any, error) {
+	c.Overlay.StopClip()
+	return nil, nil
+}
+
+// login のユーザのクリップを count 本プレイリストに追加する
+func controlClipQueue(c *BackendContext, args json.RawMessage) (any, error) {
+	v := struct {
+		Login string `json:"login"`
+		Count int    `json:"count"`
+	}{}
+	if err := parseControlArgs(args, &v); err != nil {
+		return nil, err
+	}
+	if v.Login == "" {
+		return nil, errors.New("login is required")
+	}
+	userId, _, _, _, err := referTargetUserIdWith(c.Config, v.Login)
+	if err != nil {
+		return nil, err
+	}
+	if userId == "" {
+		return nil, fmt.Errorf("user not found [%v]", v.Login)
+	}
+	clips, err := fetchUserClips(c.Config, userId, v.Count)
+	if err != nil {
+		return nil, err
+	}
+	c.Playlist.Enqueue(clips)
+	return c.Playlist.State(), nil
+}
+
+func controlPlaylist(c *BackendContext, _ json.RawMessage) (any, error) {
+	return c.Playlist.State(), nil
+}
+
+func controlPlaylistNext(c *BackendContext, _ json.RawMessage) (any, error) {
+	c.Playlist.Next()
+	return c.Playlist.State(), nil
+}
+
+func controlPlaylistPrev(c *BackendContext, _ json.RawMessage) (any, error) {
+	c.Playlist.Prev()
+	return c.Playlist.State(), nil
+}
+
+func controlPlaylistSkip(c *BackendContext, _ json.RawMessage) (any, error) {
+	c.Playlist.Skip()
+	return c.Playlist.State(), nil
+}
+
+func controlPlaylistClear(c *BackendContext, _ json.RawMessage) (any, error) {
+	c.Playlist.Clear()
+	return c.Playlist.State(), nil
+}
+
+// 引数を省略したらテスト用の名前でフォローのアラートを出す
+func controlAlertTest(c *BackendContext, args json.RawMessage) (any, error) {
+	a := Alert{Event: AlertFollow, User: "sttool"}
+	if err := parseControlArgs(args, &a); err != nil {
+		return nil, err
+	}
+	c.PushAlert(a)
+	return nil, nil
+}
+
+func controlAlertReplay(c *BackendContext, _ json.RawMessage) (any, error) {
+	return nil, c.Overlay.ReplayAlert()
+}
+
+func controlObsScene(c *BackendContext, args json.RawMessage) (any, error) {
+	v := struct {
+		Scene   string `json:"scene"`
+		Seconds int    `json:"seconds"` // 0より大きければ元のシーンに戻す
+	}{}
+	if err := parseControlArgs(args, &v); err != nil {
+		return nil, err
+	}
+	if v.Scene == "" {
+		return nil, errors.New("scene is required")
+	}
+	return nil, SwitchObsScene(c.Config, v.Scene, v.Seconds)
+}
+
+func controlStats(c *BackendContext, _ json.RawMessage) (any, error) {
+	return BuildStatsWidgets(c.Stats, c.Config.SubGoal()), nil
+}
+
+func controlSubscriptions(c *BackendContext, _ json.RawMessage) (any, error) {
+	return c.EventSubs.Report(), nil
+}
+
+func (c *BackendContext) RunControl(req *ControlRequest) *ControlResponse {
+	ret := &ControlResponse{Id: req.Id}
+	cmd, exists := ControlCommandTable[req.Command]
+	if !exists {
+		ret.Error = fmt.Sprintf("%v [%v]", ErrControlUnknownCommand, req.Command)
+		return ret
+	}
+	result, err := cmd.Func(c, req.Args)
+	if err != nil {
+		logger.Error("RunControl", slog.Any("command", req.Command), slog.Any("ERR", err.Error()))
+		ret.Error = err.Error()
+		return ret
+	}
+	logger.Info("RunControl", slog.Any("command", req.Command))
+	ret.Ok = true
+	ret.Result = result
+	return ret
+}
+
+func controlToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return r.URL.Query().Get("token")
+}
+
+func (c *BackendContext) authorizeControl(r *http.Request) error {
+	token := c.Config.ControlToken()
+	if token == "" {
+		return ErrControlDisabled
+	}
+	if subtle.ConstantTimeCompare([]byte(controlToken(r)), []byte(token)) != 1 {
+		return ErrControlUnauthorized
+	}
+	return nil
+}
+
+func writeControlResponse(w http.ResponseWriter, status int, res *ControlResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (c *BackendContext) OnControl(w http.ResponseWriter, r *http.Request) {
+	if err := c.authorizeControl(r); err != nil {
+		writeControlResponse(w, http.StatusUnauthorized, &ControlResponse{Error: err.Error()})
+		return
+	}
+	req := &ControlRequest{Command: strings.TrimPrefix(r.URL.Path, "/api/")}
+	cmd, exists := ControlCommandTable[req.Command]
+	switch {
+	case !exists:
+		writeControlResponse(w, http.StatusNotFound, &ControlResponse{Error: ErrControlUnknownCommand.Error()})
+		return
+	case r.Method == http.MethodGet && cmd.ReadOnly:
+	case r.Method == http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req.Args); err != nil && !errors.Is(err, io.EOF) {
+			writeControlResponse(w, http.StatusBadRequest, &ControlResponse{Error: err.Error()})
+			return
+		}
+	default:
+		writeControlResponse(w, http.StatusMethodNotAllowed, &ControlResponse{Error: "method not allowed"})
+		return
+	}
+	res := c.RunControl(req)
+	status := http.StatusOK
+	if !res.Ok {
+		status = http.StatusInternalServerError
+	}
+	writeControlResponse(w, status, res)
+}
+
+// Originは checkOrigin で確認済み
+var controlUpgrader = websocket.Upgrader{
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// 接続中はオーバーレイのイベントも送る(?events=stats,alertbox で絞れる)
+func (c *BackendContext) OnControlSocket(w http.ResponseWriter, r *http.Request) {
+	if err := c.authorizeControl(r); err != nil {
+		writeControlResponse(w, http.StatusUnauthorized, &ControlResponse{Error: err.Error()})
+		return
+	}
+	conn, err := controlUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Error("OnControlSocket::Upgrade", slog.Any("ERR", err.Error()))
+		return
+	}
+	defer conn.Close()
+
+	events := []string{}
+	if q := r.URL.Query().Get("events"); q != "" {
+		events = strings.Split(q, ",")
+	}
+	client := c.Overlay.Hub.Observe(events)
+	defer c.Overlay.Hub.Unsubscribe(client)
+	logger.Info("Control:Connected", slog.Any("events", events))
+
+	// 書き込みはこのgoroutineだけで行う
+	responses := make(chan *ControlResponse, OverlayClientBufferSize)
+	closed := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(closed)
+		for {
+			req := &ControlRequest{}
+			var res *ControlResponse
+			if err := conn.ReadJSON(req); err != nil {
+				var syntax *json.SyntaxError
+				if !errors.As(err, &syntax) {
+					return
+				}
+				res = &ControlResponse{Error: err.Error()}
+			} else {
+				res = c.RunControl(req)
+			}
+			select {
+			case responses <- res:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		var err error
+		select {
+		case res := <-responses:
+			err = conn.WriteJSON(res)
+		case m := <-client.ch:
+			err = conn.WriteJSON(&ControlEvent{Event: m.Event, Id: m.Id, Data: m.Data})
+		case <-closed:
+			logger.Info("Control:Disconnected")
+			return
+		}
+		if err != nil {
+			logger.Error("OnControlSocket::Write", slog.Any("ERR", err.Error()))
+			return
+		}
+	}
+}
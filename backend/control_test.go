@@ -0,0 +1,127 @@
+package backend
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func newControlTestBackend() *BackendContext {
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := &Config{}
+	cfg.Init()
+	cfg.Body.ControlApiToken = "secret"
+	c := &BackendContext{
+		Config:    cfg,
+		Overlay:   NewOverlay(cfg),
+		Stats:     NewTwitchStats(),
+		EventSubs: NewSubscriptionStatus(),
+	}
+	c.Playlist = NewClipPlaylist(cfg, c.Overlay)
+	return c
+}
+
+func callControl(t *testing.T, c *BackendContext, method, path, token, body string) (int, *ControlResponse) {
+	t.Helper()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	c.OnControl(w, r)
+	res := &ControlResponse{}
+	json.Unmarshal(w.Body.Bytes(), res)
+	return w.Code, res
+}
+
+func TestControlApi(t *testing.T) {
+	sut := newControlTestBackend()
+
+	if code, _ := callControl(t, sut, "GET", "/api/stats", "", ""); code != http.StatusUnauthorized {
+		t.Errorf("no token accepted [%v]", code)
+	}
+	if code, _ := callControl(t, sut, "GET", "/api/stats", "wrong", ""); code != http.StatusUnauthorized {
+		t.Errorf("wrong token accepted [%v]", code)
+	}
+	if code, _ := callControl(t, sut, "GET", "/api/stats?token=secret", "", ""); code != http.StatusOK {
+		t.Errorf("query token rejected [%v]", code)
+	}
+	if code, _ := callControl(t, sut, "POST", "/api/unknown", "secret", ""); code != http.StatusNotFound {
+		t.Errorf("unknown command [%v]", code)
+	}
+	if code, _ := callControl(t, sut, "GET", "/api/clip.stop", "secret", ""); code != http.StatusMethodNotAllowed {
+		t.Errorf("GET allowed for clip.stop [%v]", code)
+	}
+
+	if code, res := callControl(t, sut, "POST", "/api/alert.replay", "secret", ""); code == http.StatusOK || res.Error != ErrNoAlert.Error() {
+		t.Errorf("replay without alert [%v] [%v]", code, res)
+	}
+	c, _ := sut.Overlay.Hub.Subscribe([]string{AlertOverlayEvent}, 0)
+	if code, res := callControl(t, sut, "POST", "/api/alert.test", "secret", `{"event":"cheer","user":"alice","amount":100}`); code != http.StatusOK || !res.Ok {
+		t.Errorf("alert.test failed [%v] [%v]", code, res)
+	}
+	if code, _ := callControl(t, sut, "POST", "/api/alert.replay", "secret", ""); code != http.StatusOK {
+		t.Errorf("alert.replay failed [%v]", code)
+	}
+	for i := 0; i < 2; i++ {
+		m := <-c.ch
+		if !strings.Contains(string(m.Data), `"user":"alice"`) {
+			t.Errorf("invalid alert [%s]", m.Data)
+		}
+	}
+
+	sut.Config.Body.ControlApiToken = ""
+	if _, res := callControl(t, sut, "GET", "/api/stats", "", ""); res.Error != ErrControlDisabled.Error() {
+		t.Errorf("control api not disabled [%v]", res)
+	}
+}
+
+func TestControlSocket(t *testing.T) {
+	sut := newControlTestBackend()
+	// 切断後のログが次のテストと重ならないよう、ハンドラが終わるのを待つ
+	finished := make(chan struct{}, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sut.OnControlSocket(w, r)
+		finished <- struct{}{}
+	}))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/ws?events=stats&token="
+
+	if _, _, err := websocket.DefaultDialer.Dial(url+"wrong", nil); err == nil {
+		t.Fatalf("wrong token accepted")
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(url+"secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		conn.Close()
+		<-finished
+		<-finished
+	}()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	conn.WriteJSON(&ControlRequest{Id: "1", Command: "subscriptions"})
+	res := &ControlResponse{}
+	if err := conn.ReadJSON(res); err != nil || res.Id != "1" || !res.Ok {
+		t.Errorf("invalid response [%v] [%v]", res, err)
+	}
+
+	// 制御APIの接続はオーバーレイとして数えない
+	if n := sut.Overlay.Hub.Clients(); n != 0 {
+		t.Errorf("control socket counted as overlay [%v]", n)
+	}
+	sut.Overlay.Hub.Publish("alertbox", struct{}{})
+	sut.Overlay.Hub.Publish(StatsOverlayEvent, map[string]int{"bits": 100})
+	e := &ControlEvent{}
+	if err := conn.ReadJSON(e); err != nil || e.Event != StatsOverlayEvent || string(e.Data) != `{"bits":100}` {
+		t.Errorf("invalid event [%v] [%v]", e, err)
+	}
+}
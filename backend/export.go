@@ -0,0 +1,355 @@
+package backend
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// 配信終了時に配信履歴.txtと一緒に書き出す機械可読な統計
+// フィールドを変更したら StatsExportSchemaVersion を上げること
+const StatsExportSchemaVersion = 3
+
+type ExportUserCount struct {
+	User  UserName `json:"user"`
+	Count int      `json:"count"`
+}
+
+type ExportUserCounts struct {
+	Total int               `json:"total"`
+	Users []ExportUserCount `json:"users"`
+}
+
+type ExportEmote struct {
+	Id    string `json:"id"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type ExportChat struct {
+	Total          int               `json:"total"`
+	UniqueChatters int               `json:"unique_chatters"`
+	Chatters       []ExportUserCount `json:"chatters"`
+	FirstTime      []UserName        `json:"first_time"`
+	Emotes         []ExportEmote     `json:"emotes"`
+}
+
+type ExportCheer struct {
+	User  UserName `json:"user"`
+	Bits  int      `json:"bits"`
+	Times int      `json:"times"`
+}
+
+type ExportCheers struct {
+	TotalBits int           `json:"total_bits"`
+	Users     []ExportCheer `json:"users"`
+}
+
+type ExportSubscription struct {
+	User             UserName `json:"user"`
+	Tier             string   `json:"tier"`
+	ReSub            bool     `json:"resub"`
+	CumulativeMonths int      `json:"cumulative_months"`
+	StreakMonths     int      `json:"streak_months"`
+	DurationMonths   int      `json:"duration_months"`
+}
+
+type ExportSubTier struct {
+	Tier   string `json:"tier"`
+	Subs   int    `json:"subs"`
+	ReSubs int    `json:"resubs"`
+	Gifts  int    `json:"gifts"`
+	Points int    `json:"points"`
+}
+
+type ExportRewardInput struct {
+	Time time.Time `json:"time"`
+	User UserName  `json:"user"`
+	Text string    `json:"text"`
+}
+
+type ExportReward struct {
+	Title  ChannelPointTitle   `json:"title"`
+	Times  int                 `json:"times"`
+	Cost   int                 `json:"cost"`
+	Users  []ExportUserCount   `json:"users"`
+	Inputs []ExportRewardInput `json:"inputs"`
+}
+
+type ExportRaid struct {
+	From    UserName `json:"from"`
+	Viewers int      `json:"viewers"`
+}
+
+type ExportPowerUps struct {
+	GigantifiedEmote ExportUserCounts `json:"gigantified_emote"`
+	MessageEffect    ExportUserCounts `json:"message_effect"`
+}
+
+type StatsExport struct {
+	SchemaVersion    int                  `json:"schema_version"`
+	ToolVersion      string               `json:"tool_version"`
+	Started          time.Time            `json:"started"`
+	Finished         time.Time            `json:"finished"`
+	Follows          []UserName           `json:"follows"`
+	Chat             ExportChat           `json:"chat"`
+	Cheers           ExportCheers         `json:"cheers"`
+	Subscriptions    []ExportSubscription `json:"subscriptions"`
+	SubTiers         []ExportSubTier      `json:"sub_tiers"`
+	SubPoints        int                  `json:"sub_points"`
+	SubGifts         ExportUserCounts     `json:"sub_gifts"`
+	SubGiftReceived  []ExportUserCount    `json:"sub_gift_received"`
+	ChannelPoints    ExportUserCounts     `json:"channel_points"`
+	ChannelPointCost int                  `json:"channel_point_cost"`
+	Rewards          []ExportReward       `json:"channel_point_rewards"`
+	Raids            []ExportRaid         `json:"raids"`
+	PowerUps         ExportPowerUps       `json:"power_ups"`
+}
+
+// 回数の多い順、同数ならユーザ名順
+func toExportUserCounts(m map[UserName]int) []ExportUserCount {
+	ret := []ExportUserCount{}
+	for k, v := range m {
+		ret = append(ret, ExportUserCount{User: k, Count: v})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Count != ret[j].Count {
+			return ret[i].Count > ret[j].Count
+		}
+		return ret[i].User < ret[j].User
+	})
+	return ret
+}
+
+func BuildStatsExport(t *TwitchStats) *StatsExport {
+	s := t.Snapshot()
+	ret := &StatsExport{
+		SchemaVersion: StatsExportSchemaVersion,
+		ToolVersion:   ToolVersion,
+		Started:       s.LastPeriod.Started,
+		Finished:      s.LastPeriod.Finished,
+		Follows:       s.FollowStats.Users,
+		Chat: ExportChat{
+			Total:          s.ChatStats.Total,
+			UniqueChatters: len(s.ChatStats.Chatters),
+			Chatters:       toExportUserCounts(s.ChatStats.Chatters),
+			FirstTime:      s.ChatStats.FirstTime,
+			Emotes:         []ExportEmote{},
+		},
+		Cheers: ExportCheers{
+			TotalBits: s.CheerStats.TotalBits,
+			Users:     []ExportCheer{},
+		},
+		Subscriptions: []ExportSubscription{},
+		SubTiers:      []ExportSubTier{},
+		SubGifts: ExportUserCounts{
+			Total: s.SubGiftStats.TotalGifts,
+			Users: toExportUserCounts(s.SubGiftStats.History),
+		},
+		SubGiftReceived: toExportUserCounts(s.SubGiftReceived.History),
+		ChannelPoints: ExportUserCounts{
+			Total: s.ChannelPoinsts.TotalTimes,
+			Users: toExportUserCounts(s.ChannelPoinsts.Record),
+		},
+		ChannelPointCost: s.ChannelPoinsts.TotalCost,
+		Rewards:          []ExportReward{},
+		Raids:            []ExportRaid{},
+		PowerUps: ExportPowerUps{
+			GigantifiedEmote: ExportUserCounts{
+				Total: s.PowerUpStats.GigantifiedEmoteHistory.Times,
+				Users: toExportUserCounts(s.PowerUpStats.GigantifiedEmoteHistory.History),
+			},
+			MessageEffect: ExportUserCounts{
+				Total: s.PowerUpStats.MessegeEffectHistory.Times,
+				Users: toExportUserCounts(s.PowerUpStats.MessegeEffectHistory.History),
+			},
+		},
+	}
+	for id, e := range s.ChatStats.Emotes {
+		ret.Chat.Emotes = append(ret.Chat.Emotes, ExportEmote{Id: id, Name: e.Name, Count: e.Times})
+	}
+	sort.Slice(ret.Chat.Emotes, func(i, j int) bool {
+		if ret.Chat.Emotes[i].Count != ret.Chat.Emotes[j].Count {
+			return ret.Chat.Emotes[i].Count > ret.Chat.Emotes[j].Count
+		}
+		return ret.Chat.Emotes[i].Id < ret.Chat.Emotes[j].Id
+	})
+	for name, r := range s.CheerStats.History {
+		ret.Cheers.Users = append(ret.Cheers.Users, ExportCheer{User: name, Bits: r.Bits, Times: r.Times})
+	}
+	sort.Slice(ret.Cheers.Users, func(i, j int) bool {
+		if ret.Cheers.Users[i].Bits != ret.Cheers.Users[j].Bits {
+			return ret.Cheers.Users[i].Bits > ret.Cheers.Users[j].Bits
+		}
+		return ret.Cheers.Users[i].User < ret.Cheers.Users[j].User
+	})
+	for name, e := range s.SubScriptionStats.Entry {
+		ret.Subscriptions = append(ret.Subscriptions, ExportSubscription{
+			User:             name,
+			Tier:             e.Tier,
+			ReSub:            e.ReSub,
+			CumulativeMonths: e.CumulativeMonths,
+			StreakMonths:     e.StreakMonths,
+			DurationMonths:   e.DurationMonths,
+		})
+	}
+	sort.Slice(ret.Subscriptions, func(i, j int) bool {
+		return ret.Subscriptions[i].User < ret.Subscriptions[j].User
+	})
+	for _, b := range s.LoadSubTierBreakdown() {
+		ret.SubTiers = append(ret.SubTiers, ExportSubTier{Tier: b.Tier, Subs: b.Subs, ReSubs: b.ReSubs, Gifts: b.Gifts, Points: b.Points})
+		ret.SubPoints += b.Points
+	}
+	for title, r := range s.ChannelPoinsts.Rewards {
+		v := ExportReward{Title: title, Times: r.Times, Cost: r.Cost, Users: toExportUserCounts(r.Users), Inputs: []ExportRewardInput{}}
+		for _, in := range r.Inputs {
+			v.Inputs = append(v.Inputs, ExportRewardInput{Time: in.Time, User: in.User, Text: in.Text})
+		}
+		ret.Rewards = append(ret.Rewards, v)
+	}
+	sort.Slice(ret.Rewards, func(i, j int) bool {
+		if ret.Rewards[i].Times != ret.Rewards[j].Times {
+			return ret.Rewards[i].Times > ret.Rewards[j].Times
+		}
+		return ret.Rewards[i].Title < ret.Rewards[j].Title
+	})
+	for _, e := range s.RaidStats.History {
+		ret.Raids = append(ret.Raids, ExportRaid{From: e.From, Viewers: e.Viewers})
+	}
+	return ret
+}
+
+// カテゴリ名とCSVの中身(1行目はヘッダ)
+func (e *StatsExport) CsvTables() map[string][][]string {
+	userCounts := func(l []ExportUserCount) [][]string {
+		ret := [][]string{{"user", "count"}}
+		for _, v := range l {
+			ret = append(ret, []string{string(v.User), strconv.Itoa(v.Count)})
+		}
+		return ret
+	}
+	follows := [][]string{{"user"}}
+	for _, v := range e.Follows {
+		follows = append(follows, []string{string(v)})
+	}
+	firstTime := [][]string{{"user"}}
+	for _, v := range e.Chat.FirstTime {
+		firstTime = append(firstTime, []string{string(v)})
+	}
+	emotes := [][]string{{"id", "name", "count"}}
+	for _, v := range e.Chat.Emotes {
+		emotes = append(emotes, []string{v.Id, v.Name, strconv.Itoa(v.Count)})
+	}
+	cheers := [][]string{{"user", "bits", "times"}}
+	for _, v := range e.Cheers.Users {
+		cheers = append(cheers, []string{string(v.User), strconv.Itoa(v.Bits), strconv.Itoa(v.Times)})
+	}
+	subscriptions := [][]string{{"user", "tier", "resub", "cumulative_months", "streak_months", "duration_months"}}
+	for _, v := range e.Subscriptions {
+		subscriptions = append(subscriptions, []string{
+			string(v.User),
+			v.Tier,
+			strconv.FormatBool(v.ReSub),
+			strconv.Itoa(v.CumulativeMonths),
+			strconv.Itoa(v.StreakMonths),
+			strconv.Itoa(v.DurationMonths),
+		})
+	}
+	subTiers := [][]string{{"tier", "subs", "resubs", "gifts", "points"}}
+	for _, v := range e.SubTiers {
+		subTiers = append(subTiers, []string{
+			v.Tier,
+			strconv.Itoa(v.Subs),
+			strconv.Itoa(v.ReSubs),
+			strconv.Itoa(v.Gifts),
+			strconv.Itoa(v.Points),
+		})
+	}
+	rewards := [][]string{{"title", "times", "cost"}}
+	rewardUsers := [][]string{{"title", "user", "count"}}
+	rewardInputs := [][]string{{"time", "title", "user", "text"}}
+	for _, v := range e.Rewards {
+		rewards = append(rewards, []string{string(v.Title), strconv.Itoa(v.Times), strconv.Itoa(v.Cost)})
+		for _, u := range v.Users {
+			rewardUsers = append(rewardUsers, []string{string(v.Title), string(u.User), strconv.Itoa(u.Count)})
+		}
+		for _, in := range v.Inputs {
+			rewardInputs = append(rewardInputs, []string{in.Time.Format(time.RFC3339), string(v.Title), string(in.User), in.Text})
+		}
+	}
+	raids := [][]string{{"from", "viewers"}}
+	for _, v := range e.Raids {
+		raids = append(raids, []string{string(v.From), strconv.Itoa(v.Viewers)})
+	}
+	return map[string][][]string{
+		"follows":           follows,
+		"chatters":          userCounts(e.Chat.Chatters),
+		"first_chatters":    firstTime,
+		"emotes":            emotes,
+		"cheers":            cheers,
+		"subscriptions":     subscriptions,
+		"sub_tiers":         subTiers,
+		"sub_gifts":         userCounts(e.SubGifts.Users),
+		"sub_gift_received": userCounts(e.SubGiftReceived),
+		"channel_points":    userCounts(e.ChannelPoints.Users),
+		"rewards":           rewards,
+		"reward_users":      rewardUsers,
+		"reward_inputs":     rewardInputs,
+		"raids":             raids,
+		"gigantified_emote": userCounts(e.PowerUps.GigantifiedEmote.Users),
+		"message_effect":    userCounts(e.PowerUps.MessageEffect.Users),
+	}
+}
+
+func writeCsv(path string, rows [][]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// Excelで開いても文字化けしないようにBOMを付ける
+	f.WriteString("\uFEFF")
+	w := csv.NewWriter(f)
+	w.WriteAll(rows)
+	return w.Error()
+}
+
+// 配信履歴.txtへの追記と機械可読な統計の書き出し
+func writeStreamSummary(cfg *Config, s *TwitchStats) {
+	log, _ := os.OpenFile(cfg.StatsLogFullPath(), os.O_APPEND|os.O_RDWR|os.O_CREATE, 0666)
+	defer log.Close()
+	log.WriteString(s.RenderWith(cfg))
+	if err := ExportStats(cfg, s); err != nil {
+		logger.Error("ExportStats", slog.Any("ERR", err.Error()))
+	}
+}
+
+// <LogDest>/<StatsExportDir>/<配信開始日時>.json と <配信開始日時>_<カテゴリ>.csv を出力する
+func ExportStats(cfg *Config, t *TwitchStats) error {
+	e := BuildStatsExport(t)
+	dir := cfg.StatsExportFullPath()
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+	base := e.Started.Format("20060102_150405")
+	body, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, base+".json"), body, 0644); err != nil {
+		return err
+	}
+	for category, rows := range e.CsvTables() {
+		path := filepath.Join(dir, fmt.Sprintf("%v_%v.csv", base, category))
+		if err := writeCsv(path, rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -88,25 +88,55 @@ type GetUsersApiResponce struct {
 	} `json:"data"`
 }
 
+type ClipData struct {
+	Id              string  `json:"id"`
+	Url             string  `json:"url"`
+	EmbedUrl        string  `json:"embed_url"`
+	BroadcasterId   string  `json:"broadcaster_id"`
+	BroadcasterName string  `json:"broadcaster_name"`
+	CreatorId       string  `json:"creator_id"`
+	CreatorName     string  `json:"creator_name"`
+	VideoId         string  `json:"video_id"`
+	GameId          string  `json:"game_id"`
+	Language        string  `json:"language"`
+	Title           string  `json:"title"`
+	ViewCount       int     `json:"view_count"`
+	CreatedAt       string  `json:"created_at"`
+	ThumbnailUrl    string  `json:"thumbnail_url"`
+	Duration        float32 `json:"duration"`
+	VodOffset       int     `json:"vod_offset"`
+	IsFeatured      bool    `json:"is_featured"`
+}
+
 type GetClipsApiResponce struct {
+	Data []ClipData `json:"data"`
+}
+
+type GetStreamsApiResponce struct {
+	Data []struct {
+		Id           string `json:"id"`
+		UserId       string `json:"user_id"`
+		UserLogin    string `json:"user_login"`
+		UserName     string `json:"user_name"`
+		Type         string `json:"type"`
+		Title        string `json:"title"`
+		ViewerCount  int    `json:"viewer_count"`
+		StartedAt    string `json:"started_at"`
+		ThumbnailUrl string `json:"thumbnail_url"`
+	} `json:"data"`
+}
+
+// https://dev.twitch.tv/docs/api/reference/#get-global-chat-badges
+type GetChatBadgesResponce struct {
 	Data []struct {
-		Id              string  `json:"id"`
-		Url             string  `json:"url"`
-		EmbedUrl        string  `json:"embed_url"`
-		BroadcasterId   string  `json:"broadcaster_id"`
-		BroadcasterName string  `json:"broadcaster_name"`
-		CreatorId       string  `json:"creator_id"`
-		CreatorName     string  `json:"creator_name"`
-		VideoId         string  `json:"video_id"`
-		GameId          string  `json:"game_id"`
-		Language        string  `json:"language"`
-		Title           string  `json:"title"`
-		ViewCount       int     `json:"view_count"`
-		CreatedAt       string  `json:"created_at"`
-		ThumbnailUrl    string  `json:"thumbnail_url"`
-		Duration        float32 `json:"duration"`
-		VodOffset       int     `json:"vod_offset"`
-		IsFeatured      bool    `json:"is_featured"`
+		SetId    string `json:"set_id"`
+		Versions []struct {
+			Id         string `json:"id"`
+			ImageUrl1x string `json:"image_url_1x"`
+			ImageUrl2x string `json:"image_url_2x"`
+			ImageUrl4x string `json:"image_url_4x"`
+			Title      string `json:"title"`
+		} `json:"versions"`
 	} `json:"data"`
 }
 
@@ -152,6 +182,23 @@ type GetCustomRewardResponce struct {
 	} `json:"data"`
 }
 
+// カスタム報酬の作成・更新で送る内容
+type CustomRewardBody struct {
+	Title                             string `json:"title"`
+	Cost                              int    `json:"cost"`
+	Prompt                            string `json:"prompt"`
+	IsEnabled                         bool   `json:"is_enabled"`
+	BackgroundColor                   string `json:"background_color,omitempty"`
+	IsUserInputRequired               bool   `json:"is_user_input_required"`
+	IsMaxPerStreamEnabled             bool   `json:"is_max_per_stream_enabled"`
+	MaxPerStream                      int    `json:"max_per_stream,omitempty"`
+	IsMaxPerUserPerStreamEnabled      bool   `json:"is_max_per_user_per_stream_enabled"`
+	MaxPerUserPerStream               int    `json:"max_per_user_per_stream,omitempty"`
+	IsGlobalCooldownEnabled           bool   `json:"is_global_cooldown_enabled"`
+	GlobalCooldownSeconds             int    `json:"global_cooldown_seconds,omitempty"`
+	ShouldRedemptionsSkipRequestQueue bool   `json:"should_redemptions_skip_request_queue"`
+}
+
 // --- EventSub notification
 
 type MetadataFormat struct {
@@ -599,3 +646,49 @@ type ResponceChannelFollow struct {
 	Metadata MetadataFormat             `json:"metadata"`
 	Payload  PayloadFormatChannelFollow `json:"payload"`
 }
+
+// --------------------------------------------------------
+// https://dev.twitch.tv/docs/eventsub/eventsub-reference/#channel-chat-message-delete-event
+type EventFormatChatMessageDelete struct {
+	BroadcasterUserId    string `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string `json:"broadcaster_user_login"`
+	BroadcasterUserName  string `json:"broadcaster_user_name"`
+	TargetUserId         string `json:"target_user_id"`
+	TargetUserLogin      string `json:"target_user_login"`
+	TargetUserName       string `json:"target_user_name"`
+	MessageId            string `json:"message_id"`
+}
+
+type PayloadFormatChatMessageDelete struct {
+	Session      SessionFormat                `json:"session"`
+	Subscription SubscriptionFormat           `json:"subscription"`
+	Event        EventFormatChatMessageDelete `json:"event"`
+}
+
+type ResponceChatMessageDelete struct {
+	Metadata MetadataFormat                 `json:"metadata"`
+	Payload  PayloadFormatChatMessageDelete `json:"payload"`
+}
+
+// --------------------------------------------------------
+// channel.chat.clear と channel.chat.clear_user_messages で共通
+// (clear のときは Target* が空)
+type EventFormatChatClear struct {
+	BroadcasterUserId    string `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string `json:"broadcaster_user_login"`
+	BroadcasterUserName  string `json:"broadcaster_user_name"`
+	TargetUserId         string `json:"target_user_id"`
+	TargetUserLogin      string `json:"target_user_login"`
+	TargetUserName       string `json:"target_user_name"`
+}
+
+type PayloadFormatChatClear struct {
+	Session      SessionFormat        `json:"session"`
+	Subscription SubscriptionFormat   `json:"subscription"`
+	Event        EventFormatChatClear `json:"event"`
+}
+
+type ResponceChatClear struct {
+	Metadata MetadataFormat         `json:"metadata"`
+	Payload  PayloadFormatChatClear `json:"payload"`
+}
@@ -0,0 +1,689 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// 配信をまたいだ履歴
+// 配信ごとのセッションと、handleNotificationで受けた通知(チャットを除く)を記録する
+// 問い合わせで通知をすべてたどらなくてすむよう、ユーザごと、月ごとの集計も記録時に更新する
+// 設定の変更で開き直すので、db はロックを取ってから使う
+type History struct {
+	mu       sync.RWMutex
+	db       *bolt.DB
+	boardsMu sync.Mutex
+	boards   map[string]*Leaderboards // 記録が変わるまで使い回すランキング
+	boardGen uint64                   // 記録が変わるたびに増やす
+}
+
+type StreamSession struct {
+	Id       string
+	Started  time.Time
+	Finished time.Time
+}
+
+type HistoryEvent struct {
+	Time      time.Time
+	Session   string // 配信外の通知は空
+	Type      string // サブスクリプションタイプ
+	Notice    string // channel.chat.notification の notice_type
+	UserLogin string
+	UserName  UserName
+	Amount    int // ビッツ数、サブギフ個数、レイド人数
+	Tier      string
+	Months    int
+	IsGift    bool
+	Payload   json.RawMessage
+}
+
+type HistorySub struct {
+	Time   time.Time
+	Type   string
+	Tier   string
+	Months int
+	IsGift bool
+}
+
+type HistoryRaid struct {
+	Time    time.Time
+	Viewers int
+}
+
+type UserHistory struct {
+	Login       string
+	Name        UserName
+	FirstSeen   time.Time
+	LastSeen    time.Time
+	FirstFollow time.Time
+	Subs        []HistorySub
+	SubGifts    int
+	TotalBits   int
+	Raids       []HistoryRaid
+	Chats       int
+	Redemptions int
+	Streams     int // 何回の配信に来てくれたか
+}
+
+type MonthlyTotal struct {
+	Month       string
+	Streams     int
+	Follows     int
+	Subs        int
+	SubGifts    int
+	Bits        int
+	Raids       int
+	Chats       int
+	Redemptions int
+}
+
+var (
+	historyBucketSessions     = []byte("sessions")
+	historyBucketEvents       = []byte("events")        // 時刻(8byte) + 連番(8byte) -> HistoryEvent
+	historyBucketUsers        = []byte("users")         // login -> historyUser
+	historyBucketMonths       = []byte("months")        // 2006-01 -> MonthlyTotal
+	historyBucketSessionUsers = []byte("session_users") // session + 0x00 + login -> historySessionUser
+
+	ErrHistoryUnavailable = errors.New("history database unavailable")
+)
+
+// ユーザごとの集計。問い合わせのたびに通知をたどらなくてすむよう記録時に更新する
+type historyUser struct {
+	UserHistory
+	FirstSession    string // 最初に来た配信
+	LastSession     string
+	ChatStreams     int // チャットした配信の数(ランキングの出席)
+	LastChatSession string
+}
+
+// 配信ごとに来た人
+type historySessionUser struct {
+	Name  UserName
+	Chats int
+}
+
+// 通知の種類によらずユーザや数値を拾うための共通フォーマット
+type historyEventFields struct {
+	Payload struct {
+		Event json.RawMessage `json:"event"`
+	} `json:"payload"`
+}
+
+type historyEventBody struct {
+	UserLogin        string `json:"user_login"`
+	UserName         string `json:"user_name"`
+	ChatterUserLogin string `json:"chatter_user_login"`
+	ChatterUserName  string `json:"chatter_user_name"`
+	Bits             int    `json:"bits"`
+	Total            int    `json:"total"`
+	Tier             string `json:"tier"`
+	IsGift           bool   `json:"is_gift"`
+	CumulativeMonths int    `json:"cumulative_months"`
+	NoticeType       string `json:"notice_type"`
+	Raid             struct {
+		UserLogin   string `json:"user_login"`
+		UserName    string `json:"user_name"`
+		ViewerCount int    `json:"viewer_count"`
+	} `json:"raid"`
+	Viewers int `json:"viewers"`
+}
+
+func OpenHistory(path string) (*History, error) {
+	db, err := openHistoryDB(path)
+	if err != nil {
+		return nil, err
+	}
+	return &History{db: db}, nil
+}
+
+func openHistoryDB(path string) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{historyBucketSessions, historyBucketEvents, historyBucketUsers, historyBucketMonths, historyBucketSessionUsers} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// 前のファイルを閉じてから開く。開けなければ開き直すまで使えない
+// 使用中の通知の記録や問い合わせが終わるのを待つ
+func (h *History) Reopen(path string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.db != nil {
+		h.db.Close()
+		h.db = nil
+	}
+	db, err := openHistoryDB(path)
+	if err != nil {
+		return err
+	}
+	h.db = db
+	h.invalidateBoards()
+	return nil
+}
+
+func (h *History) Close() error {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.db == nil {
+		return nil
+	}
+	err := h.db.Close()
+	h.db = nil
+	h.invalidateBoards()
+	return err
+}
+
+func (h *History) view(f func(*bolt.Tx) error) error {
+	if h == nil {
+		return ErrHistoryUnavailable
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.db == nil {
+		return ErrHistoryUnavailable
+	}
+	return h.db.View(f)
+}
+
+func (h *History) update(f func(*bolt.Tx) error) error {
+	if h == nil {
+		return ErrHistoryUnavailable
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.db == nil {
+		return ErrHistoryUnavailable
+	}
+	return h.db.Update(f)
+}
+
+func SessionId(started time.Time) string {
+	return started.UTC().Format(time.RFC3339)
+}
+
+func (h *History) put(bucket, key []byte, v any) error {
+	if h == nil {
+		return ErrHistoryUnavailable
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return h.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put(key, body)
+	})
+}
+
+// 無ければ v はそのまま
+func getHistoryValue(b *bolt.Bucket, key []byte, v any) error {
+	raw := b.Get(key)
+	if raw == nil {
+		return nil
+	}
+	return json.Unmarshal(raw, v)
+}
+
+func putHistoryValue(b *bolt.Bucket, key []byte, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, body)
+}
+
+func (h *History) StartSession(started time.Time) error {
+	id := SessionId(started)
+	return h.put(historyBucketSessions, []byte(id), &StreamSession{Id: id, Started: started})
+}
+
+func (h *History) FinishSession(started, finished time.Time) error {
+	id := SessionId(started)
+	return h.put(historyBucketSessions, []byte(id), &StreamSession{Id: id, Started: started, Finished: finished})
+}
+
+func (h *History) Sessions() ([]StreamSession, error) {
+	if h == nil {
+		return nil, ErrHistoryUnavailable
+	}
+	ret := []StreamSession{}
+	err := h.view(func(tx *bolt.Tx) error {
+		return tx.Bucket(historyBucketSessions).ForEach(func(_, v []byte) error {
+			s := StreamSession{}
+			if err := json.Unmarshal(v, &s); err != nil {
+				return err
+			}
+			ret = append(ret, s)
+			return nil
+		})
+	})
+	return ret, err
+}
+
+func buildHistoryEvent(subscType, session string, at time.Time, raw []byte) (*HistoryEvent, error) {
+	f := &historyEventFields{}
+	if err := json.Unmarshal(raw, f); err != nil {
+		return nil, err
+	}
+	b := &historyEventBody{}
+	if len(f.Payload.Event) > 0 {
+		if err := json.Unmarshal(f.Payload.Event, b); err != nil {
+			return nil, err
+		}
+	}
+	e := &HistoryEvent{
+		Time:      at,
+		Session:   session,
+		Type:      subscType,
+		Notice:    b.NoticeType,
+		UserLogin: b.UserLogin,
+		UserName:  UserName(b.UserName),
+		Tier:      b.Tier,
+		Months:    b.CumulativeMonths,
+		IsGift:    b.IsGift,
+		Payload:   f.Payload.Event,
+	}
+	if e.UserLogin == "" {
+		e.UserLogin = b.ChatterUserLogin
+		e.UserName = UserName(b.ChatterUserName)
+	}
+	switch subscType {
+	case "channel.cheer":
+		e.Amount = b.Bits
+	case "channel.subscription.gift":
+		e.Amount = b.Total
+	case "channel.raid":
+		// 自分が出したレイドなので視聴者には数えない
+		e.Amount = b.Viewers
+	case "channel.chat.message":
+		// チャットは集計だけ残す
+		e.Payload = nil
+	case "channel.chat.notification":
+		if b.NoticeType == "raid" {
+			e.UserLogin = b.Raid.UserLogin
+			e.UserName = UserName(b.Raid.UserName)
+			e.Amount = b.Raid.ViewerCount
+		}
+	}
+	return e, nil
+}
+
+// handleNotificationで受けた通知を記録する
+func (h *History) RecordNotification(subscType, session string, raw []byte) error {
+	if h == nil {
+		return ErrHistoryUnavailable
+	}
+	e, err := buildHistoryEvent(subscType, session, time.Now(), raw)
+	if err != nil {
+		return err
+	}
+	return h.RecordEvent(e)
+}
+
+func (h *History) RecordEvent(e *HistoryEvent) error {
+	if h == nil {
+		return ErrHistoryUnavailable
+	}
+	boards := false
+	err := h.update(func(tx *bolt.Tx) error {
+		var err error
+		boards, err = applyHistoryEvent(tx, e)
+		return err
+	})
+	// 配信中のチャットのたびにランキングを作り直さないよう、使う集計が変わったときだけ捨てる
+	if err == nil && boards {
+		h.invalidateBoards()
+	}
+	return err
+}
+
+// 時刻順に並ぶので、期間を区切ってたどったり古いものから消したりできる
+func historyEventKey(at time.Time, seq uint64) []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key, uint64(max(at.UnixNano(), 0)))
+	binary.BigEndian.PutUint64(key[8:], seq)
+	return key
+}
+
+func historySessionUserKey(session, login string) []byte {
+	return []byte(session + "\x00" + login)
+}
+
+func isSubscriptionEvent(e *HistoryEvent) bool {
+	switch e.Type {
+	case "channel.subscribe", "channel.subscription.message":
+		return true
+	}
+	return false
+}
+
+// ランキングに使う集計(ビッツ、ギフト、引き換え、配信ごとの最初のチャット)が変わったら true を返す
+func applyHistoryEvent(tx *bolt.Tx, e *HistoryEvent) (bool, error) {
+	// チャットは数が多いので通知そのものは残さない
+	if e.Type != "channel.chat.message" {
+		b := tx.Bucket(historyBucketEvents)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return false, err
+		}
+		if err := putHistoryValue(b, historyEventKey(e.Time, seq), e); err != nil {
+			return false, err
+		}
+	}
+	if err := applyHistoryMonth(tx.Bucket(historyBucketMonths), e); err != nil {
+		return false, err
+	}
+	if e.UserLogin == "" {
+		return false, nil
+	}
+	login := strings.ToLower(e.UserLogin)
+	if err := applyHistoryUser(tx.Bucket(historyBucketUsers), login, e); err != nil {
+		return false, err
+	}
+	boards := false
+	switch e.Type {
+	case "channel.cheer", "channel.subscription.gift", "channel.channel_points_custom_reward_redemption.add":
+		boards = true
+	}
+	if e.Session == "" {
+		return boards, nil
+	}
+	b := tx.Bucket(historyBucketSessionUsers)
+	key := historySessionUserKey(e.Session, login)
+	u := &historySessionUser{}
+	if err := getHistoryValue(b, key, u); err != nil {
+		return false, err
+	}
+	u.Name = e.UserName
+	if e.Type == "channel.chat.message" {
+		boards = boards || u.Chats == 0
+		u.Chats += 1
+	}
+	return boards, putHistoryValue(b, key, u)
+}
+
+func applyHistoryMonth(b *bolt.Bucket, e *HistoryEvent) error {
+	key := []byte(e.Time.Local().Format("2006-01"))
+	m := &MonthlyTotal{Month: string(key)}
+	if err := getHistoryValue(b, key, m); err != nil {
+		return err
+	}
+	switch {
+	case e.Type == "channel.follow":
+		m.Follows += 1
+	case isSubscriptionEvent(e) && !e.IsGift:
+		m.Subs += 1
+	case e.Type == "channel.subscription.gift":
+		m.SubGifts += e.Amount
+	case e.Type == "channel.cheer":
+		m.Bits += e.Amount
+	case e.Type == "channel.chat.notification" && e.Notice == "raid":
+		m.Raids += 1
+	case e.Type == "channel.chat.message":
+		m.Chats += 1
+	case e.Type == "channel.channel_points_custom_reward_redemption.add":
+		m.Redemptions += 1
+	default:
+		return nil
+	}
+	return putHistoryValue(b, key, m)
+}
+
+func applyHistoryUser(b *bolt.Bucket, login string, e *HistoryEvent) error {
+	u := &historyUser{UserHistory: UserHistory{Login: login, Subs: []HistorySub{}, Raids: []HistoryRaid{}}}
+	if err := getHistoryValue(b, []byte(login), u); err != nil {
+		return err
+	}
+	if u.FirstSeen.IsZero() {
+		u.FirstSeen = e.Time
+	}
+	u.LastSeen = e.Time
+	u.Name = e.UserName
+	// 配信は時刻順に来るので、最後の配信と違えば新しい配信
+	if e.Session != "" && e.Session != u.LastSession {
+		if u.FirstSession == "" {
+			u.FirstSession = e.Session
+		}
+		u.LastSession = e.Session
+		u.Streams += 1
+	}
+	switch {
+	case e.Type == "channel.follow":
+		if u.FirstFollow.IsZero() {
+			u.FirstFollow = e.Time
+		}
+	case isSubscriptionEvent(e):
+		u.Subs = append(u.Subs, HistorySub{Time: e.Time, Type: e.Type, Tier: e.Tier, Months: e.Months, IsGift: e.IsGift})
+	case e.Type == "channel.subscription.gift":
+		u.SubGifts += e.Amount
+	case e.Type == "channel.cheer":
+		u.TotalBits += e.Amount
+	case e.Type == "channel.chat.notification" && e.Notice == "raid":
+		u.Raids = append(u.Raids, HistoryRaid{Time: e.Time, Viewers: e.Amount})
+	case e.Type == "channel.chat.message":
+		u.Chats += 1
+		if e.Session != "" && e.Session != u.LastChatSession {
+			u.LastChatSession = e.Session
+			u.ChatStreams += 1
+		}
+	case e.Type == "channel.channel_points_custom_reward_redemption.add":
+		u.Redemptions += 1
+	}
+	return putHistoryValue(b, []byte(login), u)
+}
+
+// since 以降の通知を記録順(古い順)にたどる。チャットは含まない
+func (h *History) ForEachEventSince(since time.Time, f func(*HistoryEvent) error) error {
+	if h == nil {
+		return ErrHistoryUnavailable
+	}
+	return h.view(func(tx *bolt.Tx) error {
+		c := tx.Bucket(historyBucketEvents).Cursor()
+		for k, v := c.Seek(historyEventKey(since, 0)); k != nil; k, v = c.Next() {
+			e := &HistoryEvent{}
+			if err := json.Unmarshal(v, e); err != nil {
+				logger.Error("History::ForEachEventSince", slog.Any("ERR", err.Error()))
+				continue
+			}
+			if err := f(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (h *History) user(login string) (*historyUser, error) {
+	if h == nil {
+		return nil, ErrHistoryUnavailable
+	}
+	login = strings.ToLower(login)
+	u := &historyUser{UserHistory: UserHistory{Login: login, Subs: []HistorySub{}, Raids: []HistoryRaid{}}}
+	err := h.view(func(tx *bolt.Tx) error {
+		return getHistoryValue(tx.Bucket(historyBucketUsers), []byte(login), u)
+	})
+	return u, err
+}
+
+// ユーザの集計を順にたどる
+func (h *History) forEachUser(f func(*historyUser)) error {
+	if h == nil {
+		return ErrHistoryUnavailable
+	}
+	return h.view(func(tx *bolt.Tx) error {
+		return tx.Bucket(historyBucketUsers).ForEach(func(_, v []byte) error {
+			u := &historyUser{}
+			if err := json.Unmarshal(v, u); err != nil {
+				logger.Error("History::forEachUser", slog.Any("ERR", err.Error()))
+				return nil
+			}
+			f(u)
+			return nil
+		})
+	})
+}
+
+// since 以降に始まった配信に来た人を順にたどる
+func (h *History) forEachSessionUser(since time.Time, f func(session, login string, u *historySessionUser)) error {
+	if h == nil {
+		return ErrHistoryUnavailable
+	}
+	return h.view(func(tx *bolt.Tx) error {
+		c := tx.Bucket(historyBucketSessionUsers).Cursor()
+		start := []byte{}
+		if !since.IsZero() {
+			start = []byte(SessionId(since))
+		}
+		for k, v := c.Seek(start); k != nil; k, v = c.Next() {
+			session, login, found := strings.Cut(string(k), "\x00")
+			if !found {
+				continue
+			}
+			u := &historySessionUser{}
+			if err := json.Unmarshal(v, u); err != nil {
+				continue
+			}
+			f(session, login, u)
+		}
+		return nil
+	})
+}
+
+func (h *History) UserHistory(login string) (*UserHistory, error) {
+	u, err := h.user(login)
+	if err != nil {
+		return nil, err
+	}
+	return &u.UserHistory, nil
+}
+
+func (h *History) MonthlyTotals() ([]MonthlyTotal, error) {
+	sessions, err := h.Sessions()
+	if err != nil {
+		return nil, err
+	}
+	months := map[string]*MonthlyTotal{}
+	err = h.view(func(tx *bolt.Tx) error {
+		return tx.Bucket(historyBucketMonths).ForEach(func(k, v []byte) error {
+			m := &MonthlyTotal{}
+			if err := json.Unmarshal(v, m); err != nil {
+				return err
+			}
+			months[string(k)] = m
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sessions {
+		key := s.Started.Local().Format("2006-01")
+		if _, exists := months[key]; !exists {
+			months[key] = &MonthlyTotal{Month: key}
+		}
+		months[key].Streams += 1
+	}
+	ret := []MonthlyTotal{}
+	for _, v := range months {
+		ret = append(ret, *v)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Month < ret[j].Month })
+	return ret, nil
+}
+
+// sessionの配信に来た人のうち、それより前の配信にも来ていた人(login名)
+func (h *History) ReturningViewers(session string) ([]string, error) {
+	if h == nil {
+		return nil, ErrHistoryUnavailable
+	}
+	ret := []string{}
+	err := h.view(func(tx *bolt.Tx) error {
+		users := tx.Bucket(historyBucketUsers)
+		prefix := historySessionUserKey(session, "")
+		c := tx.Bucket(historyBucketSessionUsers).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			login := string(k[len(prefix):])
+			u := &historyUser{}
+			if err := getHistoryValue(users, []byte(login), u); err != nil {
+				return err
+			}
+			if u.FirstSession != "" && u.FirstSession < session {
+				ret = append(ret, login)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// sessionより前の配信に来たことがあるか
+func (h *History) IsReturningViewer(login, session string) (bool, error) {
+	u, err := h.user(login)
+	if err != nil {
+		return false, err
+	}
+	return u.FirstSession != "" && u.FirstSession < session, nil
+}
+
+// before より前の通知と配信ごとの来場者を消す
+// ユーザごと、月ごとの集計と配信の一覧は残す
+func (h *History) Prune(before time.Time) (int, error) {
+	if h == nil {
+		return 0, ErrHistoryUnavailable
+	}
+	n := 0
+	err := h.update(func(tx *bolt.Tx) error {
+		events, err := deleteHistoryBefore(tx.Bucket(historyBucketEvents), historyEventKey(before, 0))
+		n = events
+		if err != nil {
+			return err
+		}
+		_, err = deleteHistoryBefore(tx.Bucket(historyBucketSessionUsers), []byte(SessionId(before)))
+		return err
+	})
+	h.invalidateBoards()
+	return n, err
+}
+
+// たどりながら消すと飛ばされるキーがあるので、先に集めてから消す
+func deleteHistoryBefore(b *bolt.Bucket, end []byte) (int, error) {
+	keys := [][]byte{}
+	c := b.Cursor()
+	for k, _ := c.First(); k != nil && bytes.Compare(k, end) < 0; k, _ = c.Next() {
+		keys = append(keys, bytes.Clone(k))
+	}
+	for _, k := range keys {
+		if err := b.Delete(k); err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), nil
+}
@@ -0,0 +1,250 @@
+package backend
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func buildTestNotification(event string) []byte {
+	return []byte(fmt.Sprintf(`{"metadata":{},"payload":{"subscription":{},"event":%v}}`, event))
+}
+
+func TestHistory_Record(t *testing.T) {
+	sut, err := OpenHistory(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("open error [%v]", err.Error())
+	}
+	defer sut.Close()
+
+	first := time.Date(2024, 1, 10, 20, 0, 0, 0, time.Local)
+	second := time.Date(2024, 2, 10, 20, 0, 0, 0, time.Local)
+	s1 := SessionId(first)
+	s2 := SessionId(second)
+	sut.StartSession(first)
+	sut.RecordNotification("channel.follow", s1, buildTestNotification(`{"user_login":"user1","user_name":"User1"}`))
+	sut.RecordNotification("channel.chat.message", s1, buildTestNotification(`{"chatter_user_login":"user1","chatter_user_name":"User1"}`))
+	sut.RecordNotification("channel.cheer", s1, buildTestNotification(`{"user_login":"user1","user_name":"User1","bits":100}`))
+	sut.FinishSession(first, first.Add(time.Hour))
+
+	sut.StartSession(second)
+	sut.RecordNotification("channel.chat.message", s2, buildTestNotification(`{"chatter_user_login":"user1","chatter_user_name":"User1"}`))
+	sut.RecordNotification("channel.chat.message", s2, buildTestNotification(`{"chatter_user_login":"user2","chatter_user_name":"User2"}`))
+	sut.RecordNotification("channel.cheer", s2, buildTestNotification(`{"user_login":"user1","user_name":"User1","bits":50}`))
+	sut.RecordNotification("channel.subscription.message", s2, buildTestNotification(`{"user_login":"user1","user_name":"User1","tier":"1000","cumulative_months":3}`))
+	sut.RecordNotification("channel.chat.notification", s2, buildTestNotification(`{"chatter_user_login":"user3","notice_type":"raid","raid":{"user_login":"user3","user_name":"User3","viewer_count":12}}`))
+	// 自分が出したレイドは視聴者の履歴に入らない
+	sut.RecordNotification("channel.raid", s2, buildTestNotification(`{"from_broadcaster_user_login":"streamer","from_broadcaster_user_name":"Streamer","to_broadcaster_user_login":"user4","viewers":30}`))
+
+	h, err := sut.UserHistory("User1")
+	if err != nil {
+		t.Fatalf("UserHistory error [%v]", err.Error())
+	}
+	if h.Name != "User1" || h.TotalBits != 150 || h.Chats != 2 || h.Streams != 2 {
+		t.Errorf("invalid user history [%+v]", h)
+	}
+	if h.FirstFollow.IsZero() {
+		t.Errorf("first follow not recorded")
+	}
+	if len(h.Subs) != 1 || h.Subs[0].Months != 3 {
+		t.Errorf("invalid subs [%+v]", h.Subs)
+	}
+
+	raider, _ := sut.UserHistory("user3")
+	if len(raider.Raids) != 1 || raider.Raids[0].Viewers != 12 {
+		t.Errorf("invalid raids [%+v]", raider.Raids)
+	}
+
+	for _, login := range []string{"streamer", "user4"} {
+		if h, _ := sut.UserHistory(login); h.Streams != 0 || len(h.Raids) != 0 {
+			t.Errorf("outgoing raid recorded as viewer [%+v]", h)
+		}
+	}
+
+	ret, err := sut.ReturningViewers(s2)
+	if err != nil {
+		t.Fatalf("ReturningViewers error [%v]", err.Error())
+	}
+	if len(ret) != 1 || ret[0] != "user1" {
+		t.Errorf("invalid returning viewers [%v]", ret)
+	}
+
+	monthly, err := sut.MonthlyTotals()
+	if err != nil {
+		t.Fatalf("MonthlyTotals error [%v]", err.Error())
+	}
+	if len(monthly) == 0 {
+		t.Fatalf("no monthly totals")
+	}
+	total := MonthlyTotal{}
+	for _, m := range monthly {
+		total.Streams += m.Streams
+		total.Bits += m.Bits
+		total.Raids += m.Raids
+		total.Subs += m.Subs
+	}
+	if total.Streams != 2 || total.Bits != 150 || total.Raids != 1 || total.Subs != 1 {
+		t.Errorf("invalid monthly totals [%+v]", monthly)
+	}
+}
+
+func TestHistory_Unavailable(t *testing.T) {
+	var sut *History
+	if err := sut.RecordNotification("channel.follow", "", []byte(`{}`)); err != ErrHistoryUnavailable {
+		t.Errorf("unexpected error [%v]", err)
+	}
+}
+
+func TestHistory_Leaderboards(t *testing.T) {
+	sut, err := OpenHistory(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("open error [%v]", err.Error())
+	}
+	defer sut.Close()
+
+	now := time.Now()
+	old := now.AddDate(0, -2, 0)
+	sut.RecordEvent(&HistoryEvent{Time: old, Session: SessionId(old), Type: "channel.cheer", UserLogin: "user1", UserName: "User1", Amount: 1000})
+	sut.RecordEvent(&HistoryEvent{Time: old, Session: SessionId(old), Type: "channel.chat.message", UserLogin: "user1", UserName: "User1"})
+	sut.RecordEvent(&HistoryEvent{Time: now, Session: SessionId(now), Type: "channel.cheer", UserLogin: "user2", UserName: "User2", Amount: 100})
+	sut.RecordEvent(&HistoryEvent{Time: now, Session: SessionId(now), Type: "channel.chat.message", UserLogin: "user1", UserName: "User1"})
+	sut.RecordEvent(&HistoryEvent{Time: now, Session: SessionId(now), Type: "channel.chat.message", UserLogin: "user1", UserName: "User1"})
+	sut.RecordEvent(&HistoryEvent{Time: now, Session: SessionId(now), Type: "channel.subscription.gift", UserLogin: "user3", UserName: "User3", Amount: 5})
+	sut.RecordEvent(&HistoryEvent{Time: now, Session: SessionId(now), Type: "channel.channel_points_custom_reward_redemption.add", UserLogin: "user2", UserName: "User2"})
+
+	all, err := sut.Leaderboards(LeaderboardAllTime, now, 5)
+	if err != nil {
+		t.Fatalf("Leaderboards error [%v]", err.Error())
+	}
+	if len(all.Bits) != 2 || all.Bits[0].Login != "user1" || all.Bits[0].Value != 1000 {
+		t.Errorf("invalid all time bits [%+v]", all.Bits)
+	}
+	if len(all.Attendance) != 1 || all.Attendance[0].Value != 2 {
+		t.Errorf("invalid attendance [%+v]", all.Attendance)
+	}
+	if len(all.Gifters) != 1 || all.Gifters[0].Value != 5 {
+		t.Errorf("invalid gifters [%+v]", all.Gifters)
+	}
+	if len(all.Redemptions) != 1 || all.Redemptions[0].User != "User2" {
+		t.Errorf("invalid redemptions [%+v]", all.Redemptions)
+	}
+
+	monthly, _ := sut.Leaderboards(LeaderboardMonthly, now, 5)
+	if len(monthly.Bits) != 1 || monthly.Bits[0].Login != "user2" {
+		t.Errorf("invalid monthly bits [%+v]", monthly.Bits)
+	}
+	if len(monthly.Attendance) != 1 || monthly.Attendance[0].Value != 1 {
+		t.Errorf("invalid monthly attendance [%+v]", monthly.Attendance)
+	}
+
+	// 記録が変わるまでは前の結果を使い回す
+	if again, _ := sut.Leaderboards(LeaderboardAllTime, now, 5); again != all {
+		t.Errorf("leaderboards not cached")
+	}
+	// 同じ配信の2回目以降のチャットではランキングは変わらない
+	sut.RecordEvent(&HistoryEvent{Time: now, Session: SessionId(now), Type: "channel.chat.message", UserLogin: "user1", UserName: "User1"})
+	if again, _ := sut.Leaderboards(LeaderboardAllTime, now, 5); again != all {
+		t.Errorf("cache invalidated by repeated chat")
+	}
+	sut.RecordEvent(&HistoryEvent{Time: now, Session: SessionId(now), Type: "channel.chat.message", UserLogin: "user2", UserName: "User2"})
+	updated, _ := sut.Leaderboards(LeaderboardAllTime, now, 5)
+	if updated == all || len(updated.Attendance) != 2 {
+		t.Errorf("cache not invalidated by first chat [%+v]", updated.Attendance)
+	}
+	sut.RecordEvent(&HistoryEvent{Time: now, Session: SessionId(now), Type: "channel.cheer", UserLogin: "user2", UserName: "User2", Amount: 5000})
+	if again, _ := sut.Leaderboards(LeaderboardAllTime, now, 5); again == updated || again.Bits[0].Login != "user2" || again.Bits[0].Value != 5100 {
+		t.Errorf("cache not invalidated [%+v]", again.Bits)
+	}
+	// 週が変われば集計し直す
+	weekly, _ := sut.Leaderboards(LeaderboardWeekly, now, 5)
+	if next, _ := sut.Leaderboards(LeaderboardWeekly, now.AddDate(0, 0, 7), 5); next == weekly || !next.Since.After(weekly.Since) {
+		t.Errorf("cache used across windows [%v] [%v]", weekly.Since, next.Since)
+	}
+
+	since := LeaderboardSince(LeaderboardWeekly, time.Date(2024, 5, 15, 12, 0, 0, 0, time.Local))
+	if !since.Equal(time.Date(2024, 5, 13, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("invalid start of week [%v]", since)
+	}
+}
+
+func TestHistory_PruneAndAggregates(t *testing.T) {
+	sut, err := OpenHistory(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("open error [%v]", err.Error())
+	}
+	defer sut.Close()
+
+	now := time.Now()
+	old := now.AddDate(-1, 0, 0)
+	sut.RecordEvent(&HistoryEvent{Time: old, Session: SessionId(old), Type: "channel.cheer", UserLogin: "user1", UserName: "User1", Amount: 1000})
+	sut.RecordNotification("channel.chat.message", SessionId(old), buildTestNotification(`{"chatter_user_login":"user1","chatter_user_name":"User1","message":{"text":"hi"}}`))
+	sut.RecordEvent(&HistoryEvent{Time: now, Session: SessionId(now), Type: "channel.cheer", UserLogin: "user1", UserName: "User1", Amount: 10})
+
+	// チャットは通知として残さない
+	events := 0
+	sut.ForEachEventSince(time.Time{}, func(e *HistoryEvent) error {
+		if e.Type == "channel.chat.message" {
+			t.Errorf("chat message stored [%+v]", e)
+		}
+		events++
+		return nil
+	})
+	if events != 2 {
+		t.Errorf("invalid events [%v]", events)
+	}
+
+	n, err := sut.Prune(now.AddDate(0, -6, 0))
+	if err != nil || n != 1 {
+		t.Fatalf("invalid prune [%v] [%v]", n, err)
+	}
+	// 集計は消えない
+	h, _ := sut.UserHistory("user1")
+	if h.TotalBits != 1010 || h.Chats != 1 || h.Streams != 2 {
+		t.Errorf("aggregate lost after prune [%+v]", h)
+	}
+	all, _ := sut.Leaderboards(LeaderboardAllTime, now, 5)
+	if len(all.Bits) != 1 || all.Bits[0].Value != 1010 {
+		t.Errorf("invalid all time bits after prune [%+v]", all.Bits)
+	}
+	if ok, _ := sut.IsReturningViewer("user1", SessionId(now)); !ok {
+		t.Errorf("returning viewer lost after prune")
+	}
+}
+
+func TestHistory_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	sut, err := OpenHistory(filepath.Join(dir, "history.db"))
+	if err != nil {
+		t.Fatalf("open error [%v]", err.Error())
+	}
+	defer sut.Close()
+	sut.RecordEvent(&HistoryEvent{Time: time.Now(), Type: "channel.cheer", UserLogin: "user1", UserName: "User1", Amount: 1})
+
+	// 記録や問い合わせの途中で開き直しても壊れない
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			sut.RecordEvent(&HistoryEvent{Time: time.Now(), Type: "channel.cheer", UserLogin: "user1", UserName: "User1", Amount: 1})
+			sut.UserHistory("user1")
+		}
+	}()
+	for i := 0; i < 3; i++ {
+		if err := sut.Reopen(filepath.Join(dir, fmt.Sprintf("history%v.db", i))); err != nil {
+			t.Errorf("reopen error [%v]", err.Error())
+		}
+	}
+	<-done
+
+	sut.Close()
+	if err := sut.RecordEvent(&HistoryEvent{Time: time.Now(), Type: "channel.follow"}); err != ErrHistoryUnavailable {
+		t.Errorf("record after close [%v]", err)
+	}
+	if err := sut.Reopen(filepath.Join(dir, "history.db")); err != nil {
+		t.Fatalf("reopen after close error [%v]", err.Error())
+	}
+	if h, _ := sut.UserHistory("user1"); h.TotalBits == 0 {
+		t.Errorf("history lost after reopen [%+v]", h)
+	}
+}
@@ -0,0 +1,201 @@
+package backend
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 配信をまたいだランキング
+// historyの集計から数える
+const (
+	LeaderboardWeekly  = "weekly"
+	LeaderboardMonthly = "monthly"
+	LeaderboardAllTime = "all"
+)
+
+// ?window=weekly|monthly|all&n=5 で表示内容を切り替えられる
+//
+//go:embed overlay/leaderboard.html
+var LeaderboardHtml string
+
+type LeaderboardEntry struct {
+	Login string   `json:"login"`
+	User  UserName `json:"user"`
+	Value int      `json:"value"`
+}
+
+type Leaderboards struct {
+	Window      string             `json:"window"`
+	Since       time.Time          `json:"since"`
+	Bits        []LeaderboardEntry `json:"bits"`
+	Gifters     []LeaderboardEntry `json:"gifters"`
+	Redemptions []LeaderboardEntry `json:"redemptions"`
+	Attendance  []LeaderboardEntry `json:"attendance"`
+}
+
+// 集計開始日時 (週は月曜0時から、月は1日0時から)
+func LeaderboardSince(window string, now time.Time) time.Time {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch window {
+	case LeaderboardWeekly:
+		offset := (int(today.Weekday()) + 6) % 7
+		return today.AddDate(0, 0, -offset)
+	case LeaderboardMonthly:
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	}
+	return time.Time{}
+}
+
+type leaderboardCounter struct {
+	names  map[string]UserName
+	values map[string]int
+}
+
+func newLeaderboardCounter() *leaderboardCounter {
+	return &leaderboardCounter{names: map[string]UserName{}, values: map[string]int{}}
+}
+
+func (c *leaderboardCounter) add(login string, name UserName, n int) {
+	if n == 0 {
+		return
+	}
+	c.names[login] = name
+	c.values[login] += n
+}
+
+// 値の大きい順に最大n件
+func (c *leaderboardCounter) top(n int) []LeaderboardEntry {
+	ret := []LeaderboardEntry{}
+	for login, v := range c.values {
+		ret = append(ret, LeaderboardEntry{Login: login, User: c.names[login], Value: v})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Value != ret[j].Value {
+			return ret[i].Value > ret[j].Value
+		}
+		return ret[i].Login < ret[j].Login
+	})
+	if len(ret) > n {
+		ret = ret[:n]
+	}
+	return ret
+}
+
+func (h *History) invalidateBoards() {
+	h.boardsMu.Lock()
+	defer h.boardsMu.Unlock()
+	h.boards = nil
+	h.boardGen++
+}
+
+// OBSのブラウザソースから何度も呼ばれるので、記録が変わるか集計期間が変わるまで前の結果を返す
+// 返した値は書き換えないこと
+func (h *History) Leaderboards(window string, now time.Time, n int) (*Leaderboards, error) {
+	if h == nil {
+		return nil, ErrHistoryUnavailable
+	}
+	since := LeaderboardSince(window, now)
+	key := fmt.Sprintf("%v/%v", window, n)
+	h.boardsMu.Lock()
+	cached, exists := h.boards[key]
+	gen := h.boardGen
+	h.boardsMu.Unlock()
+	if exists && cached.Since.Equal(since) {
+		return cached, nil
+	}
+	ret, err := h.buildLeaderboards(window, since, n)
+	if err != nil {
+		return nil, err
+	}
+	h.boardsMu.Lock()
+	// 集計中に記録が変わっていたら残さない
+	if gen == h.boardGen {
+		if h.boards == nil {
+			h.boards = map[string]*Leaderboards{}
+		}
+		h.boards[key] = ret
+	}
+	h.boardsMu.Unlock()
+	return ret, nil
+}
+
+// 全期間はユーザごとの集計から、週と月は期間内の通知と配信ごとの来場者から数える
+func (h *History) buildLeaderboards(window string, since time.Time, n int) (*Leaderboards, error) {
+	bits := newLeaderboardCounter()
+	gifters := newLeaderboardCounter()
+	redemptions := newLeaderboardCounter()
+	attendance := newLeaderboardCounter()
+	var err error
+	if since.IsZero() {
+		err = h.forEachUser(func(u *historyUser) {
+			bits.add(u.Login, u.Name, u.TotalBits)
+			gifters.add(u.Login, u.Name, u.SubGifts)
+			redemptions.add(u.Login, u.Name, u.Redemptions)
+			attendance.add(u.Login, u.Name, u.ChatStreams)
+		})
+	} else {
+		err = h.ForEachEventSince(since, func(e *HistoryEvent) error {
+			if e.UserLogin == "" {
+				return nil
+			}
+			login := strings.ToLower(e.UserLogin)
+			switch e.Type {
+			case "channel.cheer":
+				bits.add(login, e.UserName, e.Amount)
+			case "channel.subscription.gift":
+				gifters.add(login, e.UserName, e.Amount)
+			case "channel.channel_points_custom_reward_redemption.add":
+				redemptions.add(login, e.UserName, 1)
+			}
+			return nil
+		})
+		if err == nil {
+			err = h.forEachSessionUser(since, func(_, login string, u *historySessionUser) {
+				if u.Chats > 0 {
+					attendance.add(login, u.Name, 1)
+				}
+			})
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Leaderboards{
+		Window:      window,
+		Since:       since,
+		Bits:        bits.top(n),
+		Gifters:     gifters.top(n),
+		Redemptions: redemptions.top(n),
+		Attendance:  attendance.top(n),
+	}, nil
+}
+
+func (o *OverlayContext) OnLeaderboard(w http.ResponseWriter, r *http.Request) {
+	window := r.URL.Query().Get("window")
+	switch window {
+	case LeaderboardWeekly, LeaderboardMonthly, LeaderboardAllTime:
+	default:
+		window = LeaderboardAllTime
+	}
+	n, err := strconv.Atoi(r.URL.Query().Get("n"))
+	if err != nil || n <= 0 {
+		n = LeaderboardTopN
+	}
+	// 件数ごとに結果を残すので上限を決めておく
+	n = min(n, LeaderboardMaxN)
+	ret, err := o.History.Leaderboards(window, time.Now(), n)
+	if err != nil {
+		logger.Error("Ovelay:Leaderboard", slog.Any("ERR", err.Error()))
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ret)
+}
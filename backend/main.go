@@ -3,6 +3,7 @@ package backend
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/url"
@@ -25,12 +26,20 @@ type UserClip struct {
 	Mp4       string
 }
 
+// 0の制限値は制限なし
 type ChannelPoint struct {
-	Id      string
-	Title   string
-	Cost    int
-	Enabled bool
-	Paused  bool
+	Id                    string
+	Title                 string
+	Cost                  int
+	Enabled               bool
+	Paused                bool
+	Prompt                string
+	BackgroundColor       string
+	UserInputRequired     bool
+	MaxPerStream          int
+	MaxPerUserPerStream   int
+	GlobalCooldownSeconds int
+	SkipRequestQueue      bool
 }
 
 type RaidCallbackParam struct {
@@ -41,9 +50,13 @@ type KeepAliveCallback func()
 type ConnectedCallback func()
 type RaidCallback func(*RaidCallbackParam)
 type CallBack struct {
-	KeepAlive   KeepAliveCallback
-	OnRaid      RaidCallback
-	OnConnected ConnectedCallback
+	KeepAlive    KeepAliveCallback
+	OnRaid       RaidCallback
+	OnConnected  ConnectedCallback
+	OnRedemption RedemptionCallback
+	OnPlaylist   PlaylistCallback
+	OnPlayback   PlaybackCallback
+	OnServeError ServeErrorCallback
 }
 
 type ExitStatus int
@@ -56,10 +69,17 @@ const (
 )
 
 type BackendContext struct {
-	CallBack *CallBack
-	Config   *Config
-	Overlay  *OverlayContext
-	Stats    *TwitchStats
+	CallBack    *CallBack
+	Config      *Config
+	Overlay     *OverlayContext
+	Stats       *TwitchStats
+	Chatters    *KnownChatters
+	History     *History
+	Redemptions *RedemptionQueue
+	Scripts     *ScriptEngine
+	Playlist    *ClipPlaylist
+	ChatBadges  *ChatBadges
+	EventSubs   *SubscriptionStatus
 }
 
 var (
@@ -116,27 +136,47 @@ func receive(cfg *Config, conn *websocket.Conn) (*Responce, []byte, error) {
 }
 
 // https://dev.twitch.tv/docs/eventsub/eventsub-subscription-types/#subscription-types
-func handleSessionWelcome(_ *BackendContext, cfg *Config, r *Responce, _ []byte, _ *TwitchStats) error {
+func handleSessionWelcome(ctx *BackendContext, cfg *Config, r *Responce, _ []byte, _ *TwitchStats) error {
 	if cfg.IsLocalTest() {
 		//return
 	}
+	ctx.EventSubs.Connected(r.Payload.Session.Id)
 	for k, v := range TwitchEventTable {
 		err := CreateEventSubscription(cfg, r.Payload.Session.Id, k, &v)
 		if err != nil {
 			logger.Error("handleSessionWelcome::createEventSubscription", slog.Any("ERR", err.Error()))
+			ctx.EventSubs.Set(k, SubscriptionFailed, err)
 			return err
 		}
+		ctx.EventSubs.Set(k, SubscriptionEnabled, nil)
 	}
 	return nil
 }
 
+func currentSession(stats *TwitchStats) string {
+	if !stats.IsStreaming() {
+		return ""
+	}
+	return SessionId(stats.LoadPeriodStarted())
+}
+
 func handleNotification(ctx *BackendContext, cfg *Config, r *Responce, raw []byte, stats *TwitchStats) bool {
 	logger.Info("ReceiveNotification", slog.Any("type", r.Payload.Subscription.Type))
+	// 配信終了の通知も終了した配信の分として記録する
+	session := currentSession(stats)
 	if e, exists := TwitchEventTable[r.Payload.Subscription.Type]; exists {
 		e.Handler(ctx, cfg, r, raw, stats)
+		ctx.RunRules(r.Payload.Subscription.Type, raw)
+		ctx.RunScripts(r.Payload.Subscription.Type, raw)
 	} else {
 		logger.Error("UNKNOWN notification", slog.Any("Type", r.Payload.Subscription.Type))
 	}
+	if session == "" {
+		session = currentSession(stats)
+	}
+	if err := ctx.History.RecordNotification(r.Payload.Subscription.Type, session, raw); err != nil {
+		logger.Error("History::RecordNotification", slog.Any("ERR", err.Error()))
+	}
 	if r.Payload.Subscription.Type == "stream.offline" {
 		return false
 	}
@@ -189,8 +229,42 @@ func NewBackend(callback *CallBack) *BackendContext {
 	ctx.Config = cfg
 	path := buildLogPath(cfg)
 	logger, statsLogger = buildLogger(cfg, path)
+	if err := cfg.RuleError(); err != nil {
+		logger.Error("CompileRules", slog.Any("ERR", err.Error()))
+	}
 	ctx.Stats = NewTwitchStats()
+	ctx.Chatters = LoadKnownChatters(cfg.KnownChattersFullPath())
+	ctx.History, err = OpenHistory(cfg.HistoryFullPath())
+	if err != nil {
+		logger.Error("OpenHistory", slog.Any("ERR", err.Error()))
+		// 設定を直したときに Reload で開き直せるようにしておく
+		ctx.History = &History{}
+	}
+	ctx.PruneHistory()
 	ctx.Overlay = NewOverlay(cfg)
+	ctx.Overlay.History = ctx.History
+	ctx.Overlay.OnServeError = callback.OnServeError
+	ctx.Overlay.WatchStats(ctx.Stats)
+	ctx.ChatBadges = NewChatBadges(cfg)
+	ctx.EventSubs = NewSubscriptionStatus()
+	ctx.Overlay.Handle("/api/ws", ctx.OnControlSocket)
+	ctx.Overlay.Handle("/api/", ctx.OnControl)
+	ctx.Playlist = NewClipPlaylist(cfg, ctx.Overlay)
+	ctx.Playlist.OnChanged = callback.OnPlaylist
+	ctx.Overlay.OnPlayback = func(s PlaybackState) {
+		if s.State == PlaybackEnded || s.State == PlaybackError {
+			ctx.Playlist.Ended(s.Origin)
+		}
+		if callback.OnPlayback != nil {
+			callback.OnPlayback(s)
+		}
+	}
+	ctx.Redemptions = NewRedemptionQueue()
+	ctx.Redemptions.OnChanged = callback.OnRedemption
+	ctx.Scripts = NewScriptEngine(ctx)
+	if err := ctx.ReloadScripts(); err != nil {
+		logger.Error("ReloadScripts", slog.Any("ERR", err.Error()))
+	}
 	return ctx
 }
 
@@ -236,7 +310,8 @@ func (c *BackendContext) Progress(finishChan *chan ExitStatus, firstTime bool, c
 				return
 			}
 		case "revocation":
-			logger.Info("progress", slog.Any("event", "revocation"))
+			logger.Info("progress", slog.Any("event", "revocation"), slog.Any("type", r.Payload.Subscription.Type), slog.Any("status", r.Payload.Subscription.Status))
+			c.EventSubs.Set(r.Payload.Subscription.Type, SubscriptionRevoked, errors.New(r.Payload.Subscription.Status))
 		default:
 			logger.Error("progress::UNKNOWN", slog.Any("Type", r.Metadata.MessageType))
 		}
@@ -260,6 +335,7 @@ func (c *BackendContext) Serve() {
 		return
 	}
 	statsLogger.Info("Start", slog.Any(LogFieldName_Type, "TargetUser"), slog.Any("name", c.Config.UserName()), slog.Any("id", c.Config.UserId()))
+	RestoreStatsCheckpoint(c.Config, c.Stats)
 
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt)
@@ -270,6 +346,7 @@ func (c *BackendContext) Serve() {
 
 	done := make(chan struct{})
 	StartWatcher(c.Config, done)
+	StartStatsCheckpoint(c.Config, c.Stats, done)
 	if c.Config.OverlayEnabled() {
 		c.Overlay.Serve(c.Config)
 	}
@@ -281,7 +358,7 @@ func (c *BackendContext) Serve() {
 			conn.Close()
 			if status == StreamFinished {
 				logger.Info("stream finished exit serve")
-				done <- struct{}{}
+				close(done)
 				return
 			}
 			fin = make(chan ExitStatus)
@@ -289,6 +366,7 @@ func (c *BackendContext) Serve() {
 			c.ServeMain(conn, &fin, false)
 		case <-interrupt:
 			logger.Info("interrupt")
+			CheckpointStats(c.Config, c.Stats)
 
 			// Cleanly close the connection by sending a close message and then
 			// waiting (with timeout) for the server to close the connection.
@@ -314,6 +392,8 @@ func (c *BackendContext) NeedReload(newCfg *ConfigBody) bool {
 		return true
 	} else if c.Config.LocalPortNum() != newCfg.LocalServerPortNumber {
 		return true
+	} else if c.Config.BindAddress() != newCfg.ServerBindAddress {
+		return true
 	}
 	return false
 }
@@ -321,6 +401,12 @@ func (c *BackendContext) NeedReload(newCfg *ConfigBody) bool {
 func (c *BackendContext) Reload() error {
 	path := buildLogPath(c.Config)
 	logger, statsLogger = buildLogger(c.Config, path)
+	c.Chatters = LoadKnownChatters(c.Config.KnownChattersFullPath())
+	// EventSubやオーバーレイから使用中なので差し替えずに開き直す
+	if err := c.History.Reopen(c.Config.HistoryFullPath()); err != nil {
+		logger.Error("OpenHistory", slog.Any("ERR", err.Error()))
+	}
+	c.PruneHistory()
 
 	c.Overlay.Shutdown()
 	c.Overlay.Serve(c.Config)
@@ -334,6 +420,9 @@ func (c *BackendContext) LoadConfig() *ConfigBody {
 func (c *BackendContext) SaveConfig(cfg *ConfigBody) {
 	shouldReload := c.NeedReload(cfg)
 	c.Config.UpdateRaw(cfg)
+	if e := c.Config.RuleError(); e != nil {
+		logger.Error("CompileRules", slog.Any("ERR", e.Error()))
+	}
 	if e := c.Config.Save(); e != nil {
 		logger.Error("SaveConfig", slog.Any("ERR", e.Error()))
 	}
@@ -357,18 +446,49 @@ func (c *BackendContext) StopObsStream() {
 }
 
 func (c *BackendContext) ListChannelRewards() []ChannelPoint {
-	ret := []ChannelPoint{}
 	raw, e := ReferUserChannelRewards(c.Config, c.Config.TargetUserId)
 	if e != nil {
 		logger.Error("ListChannelRewards", slog.Any("ERR", e.Error()))
+		return []ChannelPoint{}
+	}
+	return toChannelPoints(raw)
+}
+
+// HISTORY_RETENTION_DAYS より古い通知を消す
+func (c *BackendContext) PruneHistory() {
+	retention := c.Config.HistoryRetention()
+	if retention <= 0 || c.History == nil {
+		return
+	}
+	n, err := c.History.Prune(time.Now().Add(-retention))
+	if err != nil {
+		logger.Error("History::Prune", slog.Any("ERR", err.Error()))
+		return
 	}
-	for _, r := range raw.Data {
-		ret = append(ret, ChannelPoint{Id: r.Id,
-			Title:   r.Title,
-			Cost:    r.Cost,
-			Enabled: r.IsEnabled,
-			Paused:  r.IsPaused,
-		})
+	logger.Info("History:Prune", slog.Any("events", n))
+}
+
+func (c *BackendContext) UserHistory(login string) (*UserHistory, error) {
+	return c.History.UserHistory(login)
+}
+
+func (c *BackendContext) MonthlyTotals() ([]MonthlyTotal, error) {
+	return c.History.MonthlyTotals()
+}
+
+// 配信中ならその配信、配信外なら最後の配信に来たリピーター
+func (c *BackendContext) ReturningViewers() ([]string, error) {
+	session := currentSession(c.Stats)
+	if session == "" {
+		sessions, err := c.History.Sessions()
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range sessions {
+			if s.Id > session {
+				session = s.Id
+			}
+		}
 	}
-	return ret
+	return c.History.ReturningViewers(session)
 }
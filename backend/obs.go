@@ -3,8 +3,11 @@ package backend
 import (
 	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/andreykaipov/goobs"
+	"github.com/andreykaipov/goobs/api/requests/sceneitems"
+	"github.com/andreykaipov/goobs/api/requests/scenes"
 )
 
 // OBS may use IPv6 address. I dont know how to use IPv6 for goobs library
@@ -52,3 +55,78 @@ func StopObsStream(cfg *Config) {
 	}
 	logger.Info("OBS stop stream", slog.Any("reponce", res))
 }
+
+// secondsが0より大きければその秒数後に元のシーンへ戻す
+func SwitchObsScene(cfg *Config, scene string, seconds int) error {
+	client, err := connectToObs(cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	current, err := client.Scenes.GetCurrentProgramScene()
+	if err != nil {
+		logger.Error("OBS GetCurrentProgramScene ERROR", slog.Any("err", err.Error()))
+		return err
+	}
+	if _, err := client.Scenes.SetCurrentProgramScene(scenes.NewSetCurrentProgramSceneParams().WithSceneName(scene)); err != nil {
+		logger.Error("OBS SetCurrentProgramScene ERROR", slog.Any("err", err.Error()))
+		return err
+	}
+	if seconds > 0 && current.SceneName != scene {
+		time.AfterFunc(time.Duration(seconds)*time.Second, func() {
+			SwitchObsScene(cfg, current.SceneName, 0)
+		})
+	}
+	return nil
+}
+
+// sceneが空なら今のシーンのソースを表示する
+// secondsが0より大きければその秒数後に非表示に戻す
+func ShowObsSource(cfg *Config, scene, source string, seconds int) error {
+	client, err := connectToObs(cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	if scene == "" {
+		current, err := client.Scenes.GetCurrentProgramScene()
+		if err != nil {
+			logger.Error("OBS GetCurrentProgramScene ERROR", slog.Any("err", err.Error()))
+			return err
+		}
+		scene = current.SceneName
+	}
+	item, err := client.SceneItems.GetSceneItemId(
+		sceneitems.NewGetSceneItemIdParams().WithSceneName(scene).WithSourceName(source),
+	)
+	if err != nil {
+		logger.Error("OBS GetSceneItemId ERROR", slog.Any("err", err.Error()))
+		return err
+	}
+	if err := setObsSceneItemEnabled(client, scene, item.SceneItemId, true); err != nil {
+		return err
+	}
+	if seconds > 0 {
+		time.AfterFunc(time.Duration(seconds)*time.Second, func() {
+			client, err := connectToObs(cfg)
+			if err != nil {
+				return
+			}
+			defer client.Disconnect()
+			setObsSceneItemEnabled(client, scene, item.SceneItemId, false)
+		})
+	}
+	return nil
+}
+
+func setObsSceneItemEnabled(client *goobs.Client, scene string, id int, enabled bool) error {
+	_, err := client.SceneItems.SetSceneItemEnabled(
+		sceneitems.NewSetSceneItemEnabledParams().WithSceneName(scene).WithSceneItemId(id).WithSceneItemEnabled(enabled),
+	)
+	if err != nil {
+		logger.Error("OBS SetSceneItemEnabled ERROR", slog.Any("err", err.Error()))
+	}
+	return err
+}
@@ -2,69 +2,69 @@ package backend
 
 import (
 	"context"
+	"crypto/sha1"
+	_ "embed"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 type OverlayContext struct {
-	ChannStartClip   chan struct{}
-	ChannStopClip    chan struct{}
+	Hub              *OverlayHub
+	Config           *Config
 	PlayMarginSecond int
-	ClipUrl          string
+	playbackMu       sync.Mutex
+	playback         PlaybackState
+	fallbacks        map[string]clipFallback // 再生できなかったときの代わり
+	ClipCache        *ClipCache
 	ServeMux         *http.ServeMux
 	Server           *http.Server
+	History          *History
+	Stats            *TwitchStats
+	mediaMu          sync.Mutex
+	Media            map[string]string // 公開キー -> ローカルのファイルパス
+	alertMu          sync.Mutex
+	lastAlert        *AlertCard
+	OnPlayback       PlaybackCallback
+	OnServeError     ServeErrorCallback
+	serveMu          sync.Mutex
+	serveError       string
+	handlers         map[string]http.HandlerFunc // Handleで追加したパス
 }
 
-const OverlayHtml = `
-<!DOCTYPE html>
-<html>
-<head>
-    <title>Go Server-Sent Events Example</title>
-</head>
-<body>
-    <div id="clip-player"></div>
-
-    <script>
-        const evtSource = new EventSource("/events");
-        const container = document.getElementById('clip-player');
-
-        evtSource.addEventListener("on", function(event) {
-            console.log('start play');
-            const data = JSON.parse(event.data);
-            container.innerHTML = ` +
-	"`<video id=\"clip-player-body\" autoplay width=\"${data.width}\" height=\"${data.height}\"> <source src=\"${data.src}\"> </video>`;" +
-	`
-            const player = document.getElementById('clip-player-body');
-            player.addEventListener('ended', function () {
-                console.log('play ended');
-                container.innerHTML = ''; // iframeをクリア
-            });
-            player.play();
-        });
-
-        evtSource.addEventListener("off", function(event) {
-            console.log('force stop');
-            container.innerHTML = ''; // iframeをクリア
-        });
-
-    </script>
-</body>
-</html>
-`
+var ErrOverlayNotConnected = errors.New("overlay not connected")
+
+// 空文字なら待ち受けを始められた
+type ServeErrorCallback func(string)
+
+//go:embed overlay/index.html
+var OverlayHtml string
 
 func NewOverlay(cfg *Config) *OverlayContext {
 	ret := &OverlayContext{
-		ChannStartClip: make(chan struct{}),
-		ChannStopClip:  make(chan struct{}),
+		Hub:    NewOverlayHub(),
+		Config: cfg,
+		Media:  map[string]string{},
+		playback: PlaybackState{
+			State: PlaybackIdle,
+		},
+		fallbacks: map[string]clipFallback{},
+		ClipCache: NewClipCache(cfg),
+		handlers:  map[string]http.HandlerFunc{},
 	}
 	return ret
 }
 
-func rootDocument(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, OverlayHtml)
-	logger.Info("Ovelay:rootDocument")
+// オーバーレイ以外の機能(制御APIなど)のパスを追加する。Serveより前に呼ぶ
+func (o *OverlayContext) Handle(path string, h http.HandlerFunc) {
+	o.handlers[path] = h
 }
 
 func buildSrcUrl(clipID string) string {
@@ -74,70 +74,110 @@ func buildSrcUrl(clipID string) string {
 	)
 }
 
-func (o *OverlayContext) StartClip(url string, duration float32) {
-	o.ClipUrl = url
-	o.ChannStartClip <- struct{}{}
-	logger.Info("Overlay:StartClip", slog.Any("url", url), slog.Any("clip time", duration))
+func (o *OverlayContext) clipSize() (int, int) {
+	if o.Config == nil {
+		return DefaultConfig.ClipPlayerWidth, DefaultConfig.ClipPlayerHeight
+	}
+	return o.Config.ClipWidth(), o.Config.ClipHeight()
 }
 
-func (o *OverlayContext) StopClip() {
-	if o.ClipUrl == "" {
-		logger.Info("Overlay", slog.Any("msg", "clip already stopped"))
-		return
+// 文字だけの通知を出す
+func (o *OverlayContext) TryShowAlert(text string) error {
+	n := o.Hub.Publish("alert", map[string]string{"text": text})
+	logger.Info("Overlay:TryShowAlert", slog.Any("text", text), slog.Any("clients", n))
+	if n == 0 {
+		return ErrOverlayNotConnected
 	}
-	o.ChannStopClip <- struct{}{}
-	logger.Info("Overlay:forceStop")
+	return nil
 }
 
-func (o *OverlayContext) OnEvent(w http.ResponseWriter, r *http.Request, cfg *Config) {
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-
-	select {
-	case <-o.ChannStartClip:
-		//src := buildSrcUrl(o.ClipId)
-		src := o.ClipUrl
-		fmt.Fprintf(w,
-			"event: on\ndata: {\"src\": \"%s\", \"width\": \"%v\", \"height\": \"%v\"}\n\n",
-			src, cfg.ClipWidth(), cfg.ClipHeight(),
-		)
-		logger.Info("Ovelay:ON",
-			slog.Any("clip ID", o.ClipUrl),
-			slog.Any("URL", src),
-			slog.Any("x", cfg.ClipWidth()),
-			slog.Any("y", cfg.ClipHeight()),
-		)
-	case <-o.ChannStopClip:
-		fmt.Fprintf(w, "event: off\ndata: {}\n\n")
-		logger.Info("Ovelay:OFF")
-	}
-	if f, ok := w.(http.Flusher); ok {
-		f.Flush()
-	} else {
-		logger.Error("Ovelay:Streaming unsupported.")
-	}
+// ローカルのファイルをオーバーレイから再生できるようにしてURLを返す
+// 登録したファイル以外は配信しない
+func (o *OverlayContext) PublishMedia(path string) string {
+	key := fmt.Sprintf("%x%v", sha1.Sum([]byte(path)), filepath.Ext(path))
+	o.mediaMu.Lock()
+	defer o.mediaMu.Unlock()
+	o.Media[key] = path
+	return "/media/" + key
+}
 
+func (o *OverlayContext) OnMedia(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/media/")
+	o.mediaMu.Lock()
+	path, exists := o.Media[key]
+	o.mediaMu.Unlock()
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeFile(w, r, path)
 }
 
 func (o *OverlayContext) Main(cfg *Config) {
 	logger.Info("Ovelay:Start")
+	o.Config = cfg
+	// Shutdownで接続中のイベントストリームを終わらせる
+	done := make(chan struct{})
 	o.ServeMux = http.NewServeMux()
-	o.ServeMux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
-		o.OnEvent(w, r, cfg)
-	})
-	o.ServeMux.HandleFunc("/", rootDocument)
+	page := o.requireOverlayToken
+	o.ServeMux.HandleFunc("/events", page(func(w http.ResponseWriter, r *http.Request) {
+		o.Hub.ServeEvents(w, r, done)
+	}))
+	o.ServeMux.HandleFunc("/leaderboard.json", page(o.OnLeaderboard))
+	o.ServeMux.HandleFunc("/stats.json", page(o.OnStats))
+	for _, p := range OverlayPages {
+		if p.Path != "/" {
+			o.ServeMux.HandleFunc(p.Path, page(o.pageHandler(p)))
+		}
+	}
+	o.ServeMux.HandleFunc("/media/", page(o.OnMedia))
+	o.ServeMux.HandleFunc("/playback", page(o.checkOrigin(o.OnPlaybackReport)))
+	// 制御APIなどは自前の合言葉で確認する
+	for path, h := range o.handlers {
+		o.ServeMux.HandleFunc(path, o.checkOrigin(h))
+	}
+	o.ServeMux.HandleFunc("/", page(o.OnRoot))
 	o.Server = &http.Server{
-		Addr:    fmt.Sprintf(":%v", cfg.LocalPortNum()),
+		Addr:    net.JoinHostPort(cfg.BindAddress(), strconv.Itoa(cfg.LocalPortNum())),
 		Handler: o.ServeMux,
 	}
+	o.Server.RegisterOnShutdown(func() { close(done) })
 
-	if err := o.Server.ListenAndServe(); err != nil {
-		logger.Error("Ovelay:ERROR", slog.Any("error", err.Error))
+	// ポートが使われているなどで待ち受けられなかったときはフロントエンドに知らせる
+	ln, err := net.Listen("tcp", o.Server.Addr)
+	if err != nil {
+		logger.Error("Ovelay:Listen", slog.Any("addr", o.Server.Addr), slog.Any("ERR", err.Error()))
+		o.setServeError(err)
+		return
+	}
+	o.setServeError(nil)
+	if err := o.Server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("Ovelay:Serve", slog.Any("ERR", err.Error()))
+		o.setServeError(err)
 	}
 	logger.Info("Ovelay:Finish")
 }
 
+// 待ち受けできていなければその理由を返す
+func (o *OverlayContext) ServeError() string {
+	o.serveMu.Lock()
+	defer o.serveMu.Unlock()
+	return o.serveError
+}
+
+func (o *OverlayContext) setServeError(err error) {
+	msg := ""
+	if err != nil {
+		msg = err.Error()
+	}
+	o.serveMu.Lock()
+	o.serveError = msg
+	o.serveMu.Unlock()
+	if o.OnServeError != nil {
+		o.OnServeError(msg)
+	}
+}
+
 func (o *OverlayContext) Serve(cfg *Config) {
 	go func() {
 		o.Main(cfg)
@@ -0,0 +1,111 @@
+package backend
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+func matchToken(got, want string) bool {
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+// OVERLAY_TOKEN を設定したときは ?token= か Cookie が必要
+// ページを ?token= 付きで開くとCookieに入れるので、ページの中の /events などはそのままでよい
+func (o *OverlayContext) requireOverlayToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		want := ""
+		if o.Config != nil {
+			want = o.Config.OverlayToken()
+		}
+		if want == "" {
+			next(w, r)
+			return
+		}
+		if q := r.URL.Query().Get("token"); q != "" && matchToken(q, want) {
+			http.SetCookie(w, &http.Cookie{
+				Name:     OverlayTokenCookie,
+				Value:    q,
+				Path:     "/",
+				HttpOnly: true,
+				SameSite: http.SameSiteStrictMode,
+			})
+			next(w, r)
+			return
+		}
+		if c, err := r.Cookie(OverlayTokenCookie); err == nil && matchToken(c.Value, want) {
+			next(w, r)
+			return
+		}
+		logger.Error("Overlay:requireOverlayToken", slog.Any("path", r.URL.Path), slog.Any("remote", r.RemoteAddr))
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+	}
+}
+
+// このサーバを指しているHostか
+// DNSリバインディングでは攻撃側のドメイン名がHostに来るので、ループバックか待ち受けのアドレスだけ認める
+func (o *OverlayContext) isServerHost(host string) bool {
+	name, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return false
+	}
+	if o.Config != nil && port != strconv.Itoa(o.Config.LocalPortNum()) {
+		return false
+	}
+	if strings.EqualFold(name, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(name)
+	if ip != nil && ip.IsLoopback() {
+		return true
+	}
+	if o.Config == nil {
+		return false
+	}
+	bind := o.Config.BindAddress()
+	if strings.EqualFold(name, bind) {
+		return true
+	}
+	// 0.0.0.0 で待ち受けているときはほかのPCからIPアドレスで開かれる
+	b := net.ParseIP(bind)
+	return ip != nil && (bind == "" || (b != nil && b.IsUnspecified()))
+}
+
+// Originが無い(ブラウザ以外のツール)か、このサーバ自身のページか、CONTROL_ALLOWED_ORIGINS にあれば許可する
+func (o *OverlayContext) allowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && u.Host == r.Host && o.isServerHost(r.Host) {
+		return true
+	}
+	return o.Config != nil && slices.Contains(o.Config.ControlOrigins(), origin)
+}
+
+// 操作を受け付けるパス用。ほかのサイトのページから呼ばれないようにする
+func (o *OverlayContext) checkOrigin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !o.allowedOrigin(r) {
+			logger.Error("Overlay:checkOrigin", slog.Any("path", r.URL.Path), slog.Any("origin", r.Header.Get("Origin")))
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Vary", "Origin")
+		}
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next(w, r)
+	}
+}
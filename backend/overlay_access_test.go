@@ -0,0 +1,142 @@
+package backend
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newAccessTestOverlay() *OverlayContext {
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := &Config{}
+	cfg.Init()
+	cfg.Body.OverlayAccessToken = "secret"
+	cfg.Body.ControlAllowedOrigins = []string{"https://deck.example"}
+	return NewOverlay(cfg)
+}
+
+func TestOverlayToken(t *testing.T) {
+	sut := newAccessTestOverlay()
+	h := sut.requireOverlayToken(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	call := func(path string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", path, nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		h(w, r)
+		return w
+	}
+
+	if w := call("/chat", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("no token accepted [%v]", w.Code)
+	}
+	if w := call("/chat?token=wrong", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong token accepted [%v]", w.Code)
+	}
+	w := call("/chat?token=secret", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("query token rejected [%v]", w.Code)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != OverlayTokenCookie || !cookies[0].HttpOnly {
+		t.Fatalf("invalid cookie [%v]", cookies)
+	}
+	// ページの中から呼ぶ /events はCookieだけで通る
+	if w := call("/events", cookies[0]); w.Code != http.StatusOK {
+		t.Errorf("cookie rejected [%v]", w.Code)
+	}
+	if w := call("/events", &http.Cookie{Name: OverlayTokenCookie, Value: "wrong"}); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong cookie accepted [%v]", w.Code)
+	}
+
+	sut.Config.Body.OverlayAccessToken = ""
+	if w := call("/chat", nil); w.Code != http.StatusOK {
+		t.Errorf("token required without OVERLAY_TOKEN [%v]", w.Code)
+	}
+}
+
+func TestOverlayOrigin(t *testing.T) {
+	sut := newAccessTestOverlay()
+	h := sut.checkOrigin(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	call := func(method, origin string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, "http://localhost:8930/playback", strings.NewReader("{}"))
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		h(w, r)
+		return w
+	}
+
+	for _, origin := range []string{"", "http://localhost:8930", "https://deck.example"} {
+		if w := call("POST", origin); w.Code != http.StatusOK {
+			t.Errorf("origin rejected [%v] [%v]", origin, w.Code)
+		}
+	}
+	for _, origin := range []string{"https://evil.example", "http://localhost:8931", "null"} {
+		if w := call("POST", origin); w.Code != http.StatusForbidden {
+			t.Errorf("origin accepted [%v] [%v]", origin, w.Code)
+		}
+	}
+	w := call("OPTIONS", "https://deck.example")
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "https://deck.example" {
+		t.Errorf("invalid preflight [%v] [%v]", w.Code, w.Header())
+	}
+
+	// 同じHostでも、このサーバを指していないHostは信用しない(DNSリバインディング)
+	callHost := func(host string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "http://"+host+"/playback", strings.NewReader("{}"))
+		r.Header.Set("Origin", "http://"+host)
+		h(w, r)
+		return w.Code
+	}
+	sut.Config.Body.ServerBindAddress = "127.0.0.1"
+	for host, want := range map[string]int{
+		"127.0.0.1:8930":    http.StatusOK,
+		"[::1]:8930":        http.StatusOK,
+		"evil.example:8930": http.StatusForbidden,
+		"192.168.1.5:8930":  http.StatusForbidden,
+		"localhost:8931":    http.StatusForbidden,
+	} {
+		if code := callHost(host); code != want {
+			t.Errorf("host [%v] [%v] want [%v]", host, code, want)
+		}
+	}
+	// ほかのPCからはIPアドレスで開かれる
+	sut.Config.Body.ServerBindAddress = "0.0.0.0"
+	if code := callHost("192.168.1.5:8930"); code != http.StatusOK {
+		t.Errorf("LAN address rejected [%v]", code)
+	}
+	if code := callHost("evil.example:8930"); code != http.StatusForbidden {
+		t.Errorf("rebinding host accepted [%v]", code)
+	}
+}
+
+func TestOverlayListenError(t *testing.T) {
+	sut := newAccessTestOverlay()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	sut.Config.Body.ServerBindAddress = "127.0.0.1"
+	sut.Config.Body.LocalServerPortNumber = ln.Addr().(*net.TCPAddr).Port
+
+	reported := ""
+	sut.OnServeError = func(msg string) { reported = msg }
+	// 使用中のポートなので待ち受けられずにすぐ戻る
+	sut.Main(sut.Config)
+	if reported == "" || sut.ServeError() != reported {
+		t.Errorf("listen error not reported [%v] [%v]", reported, sut.ServeError())
+	}
+}
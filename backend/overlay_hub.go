@@ -0,0 +1,201 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// オーバーレイに送るイベント
+// Id は接続し直したときに Last-Event-ID で続きから受け取るための通し番号
+type OverlayMessage struct {
+	Id    uint64
+	Event string
+	Data  []byte
+}
+
+type overlayClient struct {
+	ch       chan OverlayMessage
+	events   map[string]bool // 空なら全部受け取る
+	observer bool            // 制御APIなど。オーバーレイとしては数えない
+}
+
+func (c *overlayClient) wants(event string) bool {
+	return len(c.events) == 0 || c.events[event]
+}
+
+// 接続中のブラウザソース全部に同じイベントを配る
+// 送信は待たないので、受け取りが詰まっているクライアントには届かないことがある
+type OverlayHub struct {
+	mu      sync.Mutex
+	clients map[*overlayClient]struct{}
+	lastId  uint64
+	backlog map[string][]OverlayMessage // チャットに押し出されないようイベントごとに残す
+}
+
+func NewOverlayHub() *OverlayHub {
+	return &OverlayHub{
+		clients: map[*overlayClient]struct{}{},
+		backlog: map[string][]OverlayMessage{},
+	}
+}
+
+// 届け先のクライアント数を返す
+func (h *OverlayHub) Publish(event string, data any) int {
+	bin, err := json.Marshal(data)
+	if err != nil {
+		logger.Error("OverlayHub::Publish", slog.Any("event", event), slog.Any("ERR", err.Error()))
+		return 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastId++
+	m := OverlayMessage{Id: h.lastId, Event: event, Data: bin}
+	backlog := append(h.backlog[event], m)
+	if len(backlog) > OverlayBacklogSize {
+		backlog = backlog[len(backlog)-OverlayBacklogSize:]
+	}
+	h.backlog[event] = backlog
+	n := 0
+	for c := range h.clients {
+		if !c.wants(event) {
+			continue
+		}
+		select {
+		case c.ch <- m:
+			if !c.observer {
+				n++
+			}
+		default:
+			logger.Error("OverlayHub::Publish", slog.Any("event", event), slog.Any("ERR", "client buffer full"))
+		}
+	}
+	return n
+}
+
+// lastId より後に送ったイベントも一緒に返す(0なら過去の分は返さない)
+func (h *OverlayHub) Subscribe(events []string, lastId uint64) (*overlayClient, []OverlayMessage) {
+	return h.subscribe(events, lastId, false)
+}
+
+func (h *OverlayHub) subscribe(events []string, lastId uint64, observer bool) (*overlayClient, []OverlayMessage) {
+	c := &overlayClient{
+		ch:       make(chan OverlayMessage, OverlayClientBufferSize),
+		events:   map[string]bool{},
+		observer: observer,
+	}
+	for _, e := range events {
+		c.events[e] = true
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clients[c] = struct{}{}
+	missed := []OverlayMessage{}
+	if lastId == 0 {
+		return c, missed
+	}
+	for event, backlog := range h.backlog {
+		if !c.wants(event) {
+			continue
+		}
+		for _, m := range backlog {
+			if m.Id > lastId {
+				missed = append(missed, m)
+			}
+		}
+	}
+	sort.Slice(missed, func(i, j int) bool { return missed[i].Id < missed[j].Id })
+	return c, missed
+}
+
+// 受け取るだけで、届け先やClients()の数には入らないクライアント
+func (h *OverlayHub) Observe(events []string) *overlayClient {
+	c, _ := h.subscribe(events, 0, true)
+	return c
+}
+
+func (h *OverlayHub) Unsubscribe(c *overlayClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.clients, c)
+}
+
+func (h *OverlayHub) Clients() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := 0
+	for c := range h.clients {
+		if !c.observer {
+			n++
+		}
+	}
+	return n
+}
+
+// event を受け取るオーバーレイの数(絞っていないクライアントも数える)
+func (h *OverlayHub) Subscribers(event string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := 0
+	for c := range h.clients {
+		if !c.observer && c.wants(event) {
+			n++
+		}
+	}
+	return n
+}
+
+func writeOverlayMessage(w http.ResponseWriter, m *OverlayMessage) {
+	fmt.Fprintf(w, "id: %v\nevent: %v\ndata: %s\n\n", m.Id, m.Event, m.Data)
+}
+
+// /events?events=on,off のように受け取るイベントを絞れる
+// EventSourceは再接続時に Last-Event-ID を付けてくるので、その続きから送る
+func (h *OverlayHub) ServeEvents(w http.ResponseWriter, r *http.Request, done <-chan struct{}) {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		logger.Error("Ovelay:Streaming unsupported.")
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	events := []string{}
+	if q := r.URL.Query().Get("events"); q != "" {
+		events = strings.Split(q, ",")
+	}
+	lastId, _ := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64)
+	c, missed := h.Subscribe(events, lastId)
+	defer h.Unsubscribe(c)
+	logger.Info("Ovelay:Connected", slog.Any("events", events), slog.Any("last id", lastId), slog.Any("missed", len(missed)))
+
+	for i := range missed {
+		writeOverlayMessage(w, &missed[i])
+	}
+	f.Flush()
+
+	heartbeat := time.NewTicker(OverlayHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case m := <-c.ch:
+			writeOverlayMessage(w, &m)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case <-r.Context().Done():
+			logger.Info("Ovelay:Disconnected")
+			return
+		case <-done:
+			return
+		}
+		f.Flush()
+	}
+}
@@ -0,0 +1,107 @@
+package backend
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOverlayHub_Publish(t *testing.T) {
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	sut := NewOverlayHub()
+	if n := sut.Publish("on", map[string]string{"src": "a"}); n != 0 {
+		t.Errorf("published without clients [%v]", n)
+	}
+	all, _ := sut.Subscribe(nil, 0)
+	alerts, _ := sut.Subscribe([]string{"alert"}, 0)
+	if on, alert := sut.Subscribers("on"), sut.Subscribers("alert"); on != 1 || alert != 2 {
+		t.Errorf("invalid subscribers [%v] [%v]", on, alert)
+	}
+	if n := sut.Publish("on", map[string]string{"src": "b"}); n != 1 {
+		t.Errorf("invalid clients for on [%v]", n)
+	}
+	if n := sut.Publish("alert", map[string]string{"text": "hi"}); n != 2 {
+		t.Errorf("invalid clients for alert [%v]", n)
+	}
+	if m := <-all.ch; m.Event != "on" || m.Id != 2 || string(m.Data) != `{"src":"b"}` {
+		t.Errorf("invalid message [%v:%v:%s]", m.Id, m.Event, m.Data)
+	}
+	if m := <-alerts.ch; m.Event != "alert" || m.Id != 3 {
+		t.Errorf("invalid message [%v:%v]", m.Id, m.Event)
+	}
+
+	// 詰まっているクライアントがいても待たない
+	for i := 0; i < OverlayClientBufferSize+1; i++ {
+		sut.Publish("off", struct{}{})
+	}
+	sut.Unsubscribe(all)
+	sut.Unsubscribe(alerts)
+	if sut.Clients() != 0 {
+		t.Errorf("clients remain [%v]", sut.Clients())
+	}
+
+	// チャットがたくさん流れてもクリップの分は押し出されない
+	for i := 0; i < OverlayBacklogSize+1; i++ {
+		sut.Publish("chat", struct{}{})
+	}
+	_, missed := sut.Subscribe([]string{"on", "alert"}, 1)
+	if len(missed) != 2 || missed[0].Id != 2 || missed[1].Id != 3 {
+		t.Errorf("invalid missed messages [%v]", missed)
+	}
+	_, missed = sut.Subscribe([]string{"chat"}, 1)
+	if len(missed) != OverlayBacklogSize {
+		t.Errorf("invalid chat backlog [%v]", len(missed))
+	}
+}
+
+func TestOverlayHub_ServeEvents(t *testing.T) {
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	sut := NewOverlayHub()
+	sut.Publish("on", map[string]string{"src": "a"})
+	done := make(chan struct{})
+	defer close(done)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sut.ServeEvents(w, r, done)
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"?events=on", nil)
+	req.Header.Set("Last-Event-ID", "0")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("invalid content type [%v]", ct)
+	}
+	for sut.Clients() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	sut.Publish("alert", map[string]string{"text": "skip"})
+	sut.Publish("on", map[string]string{"src": "b"})
+
+	r := bufio.NewReader(res.Body)
+	lines := []string{}
+	for len(lines) < 3 {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	want := []string{"id: 3", "event: on", `data: {"src":"b"}`}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("invalid stream [%v] want [%v]", lines, want)
+			break
+		}
+	}
+}
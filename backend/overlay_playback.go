@@ -0,0 +1,188 @@
+package backend
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	PlaybackIdle      = "idle"
+	PlaybackRequested = "requested" // オーバーレイに送ったが、まだ再生開始の通知が来ていない
+	PlaybackStarted   = "started"
+	PlaybackEnded     = "ended"
+	PlaybackError     = "error"
+	PlaybackFallback  = "fallback" // 再生できなかったので代わりのURL(CDNのmp4や埋め込みプレイヤー)で再生し直した
+
+	PlayerVideo = "video"
+	PlayerEmbed = "embed"
+)
+
+// オーバーレイのページから /playback に届く再生状況
+type PlaybackReport struct {
+	State  string `json:"state"` // started / ended / error
+	Src    string `json:"src"`
+	Reason string `json:"reason"` // error のときの理由
+}
+
+type PlaybackState struct {
+	State     string
+	Src       string // 今の(最後の)再生要求のURL
+	Origin    string // ダウンロード済みのファイルや埋め込みに切り替える前の、元のmp4のURL
+	Reason    string
+	UpdatedAt time.Time
+}
+
+// 再生が終わったかどうかは State が ended か error かで判断する
+type PlaybackCallback func(PlaybackState)
+
+type clipFallback struct {
+	Url    string
+	Player string
+}
+
+func (o *OverlayContext) Playback() PlaybackState {
+	o.playbackMu.Lock()
+	defer o.playbackMu.Unlock()
+	return o.playback
+}
+
+func (o *OverlayContext) setPlayback(state, src, origin, reason string) PlaybackState {
+	o.playback = PlaybackState{
+		State:     state,
+		Src:       src,
+		Origin:    origin,
+		Reason:    reason,
+		UpdatedAt: time.Now(),
+	}
+	return o.playback
+}
+
+func (o *OverlayContext) notifyPlayback(s PlaybackState) {
+	if o.OnPlayback != nil {
+		o.OnPlayback(s)
+	}
+}
+
+func (o *OverlayContext) publishClip(url, player string, duration float32) int {
+	w, h := o.clipSize()
+	n := o.Hub.Publish("on", map[string]any{"src": url, "player": player, "width": w, "height": h})
+	logger.Info("Overlay:StartClip", slog.Any("url", url), slog.Any("player", player), slog.Any("clip time", duration), slog.Any("clients", n))
+	return n
+}
+
+// 接続しているオーバーレイの数を返す(送信は待たない)
+func (o *OverlayContext) StartClip(url string, duration float32) int {
+	return o.StartClipWithFallback(url, "", duration)
+}
+
+// fallback は url が再生できなかったときに使う埋め込みプレイヤーのURL
+// ダウンロード済みならローカルのファイルを流し、だめならCDNのurlに戻す
+func (o *OverlayContext) StartClipWithFallback(url, fallback string, duration float32) int {
+	src, origin := url, ""
+	if path := o.ClipCache.Lookup(url); path != "" {
+		src, origin = o.PublishMedia(path), url
+	}
+	o.playbackMu.Lock()
+	// 前のクリップの分は次の再生要求で捨てる
+	o.fallbacks = map[string]clipFallback{}
+	if origin != "" {
+		o.fallbacks[src] = clipFallback{Url: url, Player: PlayerVideo}
+	}
+	if fallback != "" {
+		o.fallbacks[url] = clipFallback{Url: fallback, Player: PlayerEmbed}
+	}
+	s := o.setPlayback(PlaybackRequested, src, origin, "")
+	o.playbackMu.Unlock()
+	o.notifyPlayback(s)
+	return o.publishClip(src, PlayerVideo, duration)
+}
+
+// クリップのIDが分かるときは埋め込みプレイヤーに切り替えられるようにしておく
+func (o *OverlayContext) StartUserClip(c *UserClip) int {
+	fallback := ""
+	if c.Id != "" {
+		fallback = buildSrcUrl(c.Id)
+	}
+	return o.StartClipWithFallback(c.Mp4, fallback, c.Duration)
+}
+
+// 失敗したら返金などしたいとき用。オーバーレイが1つも開かれていなければエラーにする
+func (o *OverlayContext) TryStartClip(url string) error {
+	if o.StartClip(url, 0) == 0 {
+		return ErrOverlayNotConnected
+	}
+	return nil
+}
+
+func (o *OverlayContext) StopClip() {
+	o.playbackMu.Lock()
+	if o.playback.State == PlaybackIdle || o.playback.State == PlaybackEnded || o.playback.State == PlaybackError {
+		o.playbackMu.Unlock()
+		logger.Info("Overlay", slog.Any("msg", "clip already stopped"))
+		return
+	}
+	s := o.setPlayback(PlaybackIdle, "", "", "")
+	o.playbackMu.Unlock()
+	o.Hub.Publish("off", struct{}{})
+	logger.Info("Overlay:forceStop")
+	o.notifyPlayback(s)
+}
+
+// 再生中のもの以外(止めた後や次のクリップに移った後)の通知は無視する
+// 開いているオーバーレイの数だけ同じ通知が届くので、状態が変わらないものも無視する
+func (o *OverlayContext) ReportPlayback(r *PlaybackReport) {
+	o.playbackMu.Lock()
+	cur := o.playback
+	if r.Src != cur.Src || r.State == cur.State {
+		o.playbackMu.Unlock()
+		return
+	}
+	var s PlaybackState
+	fallback, exists := o.fallbacks[r.Src]
+	switch {
+	case r.State == PlaybackStarted:
+		if cur.State != PlaybackRequested && cur.State != PlaybackFallback {
+			o.playbackMu.Unlock()
+			return
+		}
+		s = o.setPlayback(PlaybackStarted, cur.Src, cur.Origin, "")
+	case r.State == PlaybackError && exists:
+		delete(o.fallbacks, r.Src)
+		s = o.setPlayback(PlaybackFallback, fallback.Url, originOf(cur), r.Reason)
+	case r.State == PlaybackEnded || r.State == PlaybackError:
+		delete(o.fallbacks, r.Src)
+		s = o.setPlayback(r.State, cur.Src, originOf(cur), r.Reason)
+	default:
+		o.playbackMu.Unlock()
+		return
+	}
+	o.playbackMu.Unlock()
+	logger.Info("Overlay:Playback", slog.Any("state", s.State), slog.Any("src", s.Src), slog.Any("reason", s.Reason))
+	if s.State == PlaybackFallback {
+		o.publishClip(s.Src, fallback.Player, 0)
+	}
+	o.notifyPlayback(s)
+}
+
+func originOf(s PlaybackState) string {
+	if s.Origin != "" {
+		return s.Origin
+	}
+	return s.Src
+}
+
+func (o *OverlayContext) OnPlaybackReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	report := &PlaybackReport{}
+	if err := json.NewDecoder(r.Body).Decode(report); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	o.ReportPlayback(report)
+	w.WriteHeader(http.StatusNoContent)
+}
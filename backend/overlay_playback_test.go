@@ -0,0 +1,48 @@
+package backend
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestOverlayPlayback(t *testing.T) {
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	sut := NewOverlay(nil)
+	states := []string{}
+	sut.OnPlayback = func(s PlaybackState) {
+		states = append(states, s.State)
+	}
+	all, _ := sut.Hub.Subscribe(nil, 0)
+
+	sut.StartUserClip(&UserClip{Id: "clip1", Mp4: "a.mp4"})
+	<-all.ch
+	sut.ReportPlayback(&PlaybackReport{State: PlaybackStarted, Src: "a.mp4"})
+	sut.ReportPlayback(&PlaybackReport{State: PlaybackStarted, Src: "a.mp4"})
+	sut.ReportPlayback(&PlaybackReport{State: PlaybackError, Src: "a.mp4", Reason: "4:not found"})
+	m := <-all.ch
+	if m.Event != "on" || !strings.Contains(string(m.Data), `"player":"embed"`) || !strings.Contains(string(m.Data), "clip=clip1") {
+		t.Errorf("no fallback to embed [%s]", m.Data)
+	}
+	s := sut.Playback()
+	if s.State != PlaybackFallback || s.Origin != "a.mp4" || s.Reason != "4:not found" {
+		t.Errorf("invalid fallback state [%v]", s)
+	}
+	sut.ReportPlayback(&PlaybackReport{State: PlaybackStarted, Src: s.Src})
+	sut.ReportPlayback(&PlaybackReport{State: PlaybackError, Src: s.Src, Reason: "blocked"})
+	if s := sut.Playback(); s.State != PlaybackError || s.Origin != "a.mp4" {
+		t.Errorf("invalid error state [%v]", s)
+	}
+
+	// 前のクリップの通知は無視する
+	sut.StartClip("b.mp4", 0)
+	sut.ReportPlayback(&PlaybackReport{State: PlaybackEnded, Src: "a.mp4"})
+	sut.ReportPlayback(&PlaybackReport{State: PlaybackEnded, Src: "b.mp4"})
+	sut.StopClip()
+
+	want := []string{PlaybackRequested, PlaybackStarted, PlaybackFallback, PlaybackStarted, PlaybackError, PlaybackRequested, PlaybackEnded}
+	if strings.Join(states, ",") != strings.Join(want, ",") {
+		t.Errorf("invalid states [%v] want [%v]", states, want)
+	}
+}
@@ -0,0 +1,121 @@
+package backend
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// オーバーレイのページ
+// OVERLAY_DIR に同じ名前のファイルがあればそちらを配信する
+type OverlayPage struct {
+	Path    string
+	File    string
+	Default string
+}
+
+var OverlayPages = []OverlayPage{
+	{"/", "index.html", OverlayHtml},
+	{"/leaderboard", "leaderboard.html", LeaderboardHtml},
+	{"/alerts", "alerts.html", AlertsHtml},
+	{"/chat", "chat.html", ChatHtml},
+	{"/widgets", "widgets.html", WidgetsHtml},
+}
+
+// SSEで送るイベントの説明(雛形と一緒に書き出す)
+//
+//go:embed overlay/EVENTS.md
+var OverlayEventsDoc string
+
+const OverlayEventsDocFile = "EVENTS.md"
+
+// OVERLAY_DIR のファイルを読む。無ければ組み込みのものを使う
+func (o *OverlayContext) loadPage(p *OverlayPage) string {
+	if o.Config == nil || o.Config.OverlayDir() == "" {
+		return p.Default
+	}
+	raw, err := os.ReadFile(filepath.Join(o.Config.OverlayDir(), p.File))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logger.Error("Overlay:loadPage", slog.Any("file", p.File), slog.Any("ERR", err.Error()))
+		}
+		return p.Default
+	}
+	return string(raw)
+}
+
+// どのページでも設定値のプレースホルダを使える
+func (o *OverlayContext) renderPage(page string) string {
+	cfg := o.Config
+	if cfg == nil {
+		cfg = &Config{Body: defaultConfigBody()}
+	}
+	w, h := o.clipSize()
+	return strings.NewReplacer(
+		"__MAX_LINES__", strconv.Itoa(cfg.ChatMaxLines()),
+		"__FADE_SECONDS__", strconv.Itoa(cfg.ChatFadeSeconds()),
+		"__CLIP_WIDTH__", strconv.Itoa(w),
+		"__CLIP_HEIGHT__", strconv.Itoa(h),
+	).Replace(page)
+}
+
+func (o *OverlayContext) pageHandler(p OverlayPage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, o.renderPage(o.loadPage(&p)))
+		logger.Info("Ovelay:Document", slog.Any("path", p.Path))
+	}
+}
+
+// OVERLAY_DIR にある css や画像などはそのまま配信する
+// それ以外はこれまで通りクリップ再生のページを返す
+func (o *OverlayContext) OnRoot(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" && o.Config != nil && o.Config.OverlayDir() != "" {
+		file := filepath.Join(o.Config.OverlayDir(), filepath.FromSlash(path.Clean(r.URL.Path)))
+		if info, err := os.Stat(file); err == nil && !info.IsDir() {
+			http.ServeFile(w, r, file)
+			return
+		}
+	}
+	o.pageHandler(OverlayPages[0])(w, r)
+}
+
+// 組み込みのページとイベントの説明を dir に書き出す
+// 既にあるファイルは上書きしない。書き出したファイルを返す
+func ExportOverlayPages(dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	files := map[string]string{OverlayEventsDocFile: OverlayEventsDoc}
+	for _, p := range OverlayPages {
+		files[p.File] = p.Default
+	}
+	ret := []string{}
+	for name, body := range files {
+		dest := filepath.Join(dir, name)
+		if _, err := os.Stat(dest); err == nil {
+			continue
+		}
+		if err := os.WriteFile(dest, []byte(body), 0644); err != nil {
+			return ret, err
+		}
+		ret = append(ret, dest)
+	}
+	return ret, nil
+}
+
+func (c *BackendContext) ExportOverlayPages() error {
+	if c.Config.OverlayDir() == "" {
+		return errors.New("OVERLAY_DIR is empty")
+	}
+	files, err := ExportOverlayPages(c.Config.OverlayDir())
+	logger.Info("ExportOverlayPages", slog.Any("files", files))
+	return err
+}
@@ -0,0 +1,75 @@
+package backend
+
+import (
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func getOverlayPage(t *testing.T, o *OverlayContext, path string) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", path, nil)
+	for _, p := range OverlayPages {
+		if p.Path == path && path != "/" {
+			o.pageHandler(p)(w, r)
+			return w.Body.String()
+		}
+	}
+	o.OnRoot(w, r)
+	return w.Body.String()
+}
+
+func TestOverlayPages(t *testing.T) {
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	dir := t.TempDir()
+	cfg := &Config{}
+	cfg.Init()
+	cfg.Body.OverlayDirectory = dir
+	cfg.Body.ChatOverlayMaxLines = 7
+	sut := NewOverlay(cfg)
+
+	// ファイルが無ければ組み込みのページ
+	if body := getOverlayPage(t, sut, "/alerts"); body != AlertsHtml {
+		t.Errorf("not default alerts page")
+	}
+	if body := getOverlayPage(t, sut, "/chat"); !strings.Contains(body, "|| 7)") || strings.Contains(body, "__MAX_LINES__") {
+		t.Errorf("placeholder not replaced")
+	}
+
+	os.WriteFile(filepath.Join(dir, "alerts.html"), []byte("custom __CLIP_WIDTH__ <link href=\"style.css\">"), 0644)
+	os.WriteFile(filepath.Join(dir, "style.css"), []byte("body {}"), 0644)
+	if body := getOverlayPage(t, sut, "/alerts"); body != "custom 640 <link href=\"style.css\">" {
+		t.Errorf("invalid custom page [%v]", body)
+	}
+	if body := getOverlayPage(t, sut, "/style.css"); body != "body {}" {
+		t.Errorf("invalid asset [%v]", body)
+	}
+	if body := getOverlayPage(t, sut, "/../config.yaml"); body != OverlayHtml {
+		t.Errorf("file outside OVERLAY_DIR served")
+	}
+}
+
+func TestExportOverlayPages(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "overlay")
+	os.MkdirAll(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "chat.html"), []byte("mine"), 0644)
+
+	files, err := ExportOverlayPages(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(OverlayPages) {
+		t.Errorf("invalid exported files [%v]", files)
+	}
+	if raw, _ := os.ReadFile(filepath.Join(dir, "chat.html")); string(raw) != "mine" {
+		t.Errorf("existing file overwritten")
+	}
+	if raw, _ := os.ReadFile(filepath.Join(dir, OverlayEventsDocFile)); string(raw) != OverlayEventsDoc {
+		t.Errorf("events doc not exported")
+	}
+}
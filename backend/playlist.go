@@ -0,0 +1,206 @@
+package backend
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	PlaylistClipStarted = "started"
+	PlaylistClipEnded   = "ended"
+	PlaylistChanged     = "changed"
+)
+
+type PlaylistState struct {
+	Items   []UserClip
+	Current int // 再生中の位置(-1なら何も再生していない)
+	Playing bool
+}
+
+type PlaylistCallback func(event string, state PlaylistState)
+
+// クリップを順番にオーバーレイで再生する
+// オーバーレイから終了の通知が来たら CLIP_GAP_SECONDS 待って次を流す
+// 通知が来ない(オーバーレイが開かれていない)ときはクリップの長さ+ClipEndedMarginで次へ進む
+type ClipPlaylist struct {
+	mu        sync.Mutex
+	items     []UserClip
+	current   int
+	playing   bool
+	ended     bool   // 今のクリップの終了を受け付けたか(複数のオーバーレイから届くので)
+	gen       uint64 // 古いタイマーを無視するための番号
+	timer     *time.Timer
+	sendMu    sync.Mutex // オーバーレイへの送信を操作の順に並べる
+	Config    *Config
+	Overlay   *OverlayContext
+	OnChanged PlaylistCallback
+}
+
+func NewClipPlaylist(cfg *Config, overlay *OverlayContext) *ClipPlaylist {
+	return &ClipPlaylist{
+		items:   []UserClip{},
+		current: -1,
+		Config:  cfg,
+		Overlay: overlay,
+	}
+}
+
+func (p *ClipPlaylist) state() PlaylistState {
+	items := make([]UserClip, len(p.items))
+	copy(items, p.items)
+	return PlaylistState{Items: items, Current: p.current, Playing: p.playing}
+}
+
+func (p *ClipPlaylist) State() PlaylistState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state()
+}
+
+func (p *ClipPlaylist) notify(event string, state PlaylistState) {
+	if p.OnChanged != nil {
+		p.OnChanged(event, state)
+	}
+}
+
+func (p *ClipPlaylist) stopTimer() {
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+}
+
+// オーバーレイの再生状況の通知から Ended が呼ばれるので、送信はロックを外してから行う
+// 後から別の操作があったときは古い送信はしない
+func (p *ClipPlaylist) send(gen uint64, f func()) {
+	if f == nil {
+		return
+	}
+	p.sendMu.Lock()
+	defer p.sendMu.Unlock()
+	p.mu.Lock()
+	stale := gen != p.gen
+	p.mu.Unlock()
+	if stale {
+		return
+	}
+	f()
+}
+
+// ロックを取った状態で呼ぶ。オーバーレイへの送信は返した関数を send で行う
+func (p *ClipPlaylist) play(i int) (string, func()) {
+	p.stopTimer()
+	p.gen++
+	if i < 0 || i >= len(p.items) {
+		p.playing = false
+		p.current = -1
+		return PlaylistChanged, nil
+	}
+	p.current = i
+	p.playing = true
+	p.ended = false
+	c := p.items[i]
+	gen := p.gen
+	limit := time.Duration(c.Duration*float32(time.Second)) + ClipEndedMargin
+	p.timer = time.AfterFunc(limit, func() {
+		p.finish(gen, c.Mp4)
+	})
+	return PlaylistClipStarted, func() { p.Overlay.StartUserClip(&c) }
+}
+
+func (p *ClipPlaylist) finish(gen uint64, src string) {
+	p.mu.Lock()
+	if gen != p.gen || !p.playing || p.ended || p.items[p.current].Mp4 != src {
+		p.mu.Unlock()
+		return
+	}
+	p.ended = true
+	p.stopTimer()
+	p.timer = time.AfterFunc(p.Config.ClipGap(), func() {
+		p.mu.Lock()
+		if gen != p.gen {
+			p.mu.Unlock()
+			return
+		}
+		event, send := p.play(p.current + 1)
+		next := p.gen
+		s := p.state()
+		p.mu.Unlock()
+		p.send(next, send)
+		p.notify(event, s)
+	})
+	s := p.state()
+	p.mu.Unlock()
+	logger.Info("ClipPlaylist:Ended", slog.Any("src", src))
+	p.notify(PlaylistClipEnded, s)
+}
+
+// オーバーレイから再生終了の通知を受けたとき
+func (p *ClipPlaylist) Ended(src string) {
+	p.mu.Lock()
+	gen := p.gen
+	p.mu.Unlock()
+	p.finish(gen, src)
+}
+
+func (p *ClipPlaylist) update(f func() (string, func())) {
+	p.mu.Lock()
+	event, send := f()
+	gen := p.gen
+	s := p.state()
+	p.mu.Unlock()
+	p.send(gen, send)
+	p.notify(event, s)
+}
+
+// 止まっていれば追加した先頭から再生する
+func (p *ClipPlaylist) Enqueue(clips []UserClip) {
+	p.update(func() (string, func()) {
+		start := len(p.items)
+		p.items = append(p.items, clips...)
+		if p.playing {
+			return PlaylistChanged, nil
+		}
+		return p.play(start)
+	})
+}
+
+func (p *ClipPlaylist) Next() {
+	p.update(func() (string, func()) {
+		return p.play(p.current + 1)
+	})
+}
+
+func (p *ClipPlaylist) Prev() {
+	p.update(func() (string, func()) {
+		i := p.current - 1
+		if i < 0 {
+			i = 0
+		}
+		return p.play(i)
+	})
+}
+
+// 今のクリップをリストから消して次を流す
+func (p *ClipPlaylist) Skip() {
+	p.update(func() (string, func()) {
+		if p.current < 0 || p.current >= len(p.items) {
+			return PlaylistChanged, nil
+		}
+		i := p.current
+		p.items = append(p.items[:i], p.items[i+1:]...)
+		return p.play(i)
+	})
+}
+
+func (p *ClipPlaylist) Clear() {
+	p.update(func() (string, func()) {
+		p.stopTimer()
+		p.gen++
+		p.items = []UserClip{}
+		p.current = -1
+		p.playing = false
+		return PlaylistChanged, p.Overlay.StopClip
+	})
+}
@@ -0,0 +1,112 @@
+package backend
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+type playlistEvent struct {
+	event string
+	state PlaylistState
+}
+
+func waitPlaylistEvent(t *testing.T, ch chan playlistEvent, want string, current int) {
+	t.Helper()
+	select {
+	case e := <-ch:
+		if e.event != want || e.state.Current != current {
+			t.Errorf("invalid event [%v:%v] want [%v:%v]", e.event, e.state.Current, want, current)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("event timeout [%v:%v]", want, current)
+	}
+}
+
+func TestClipPlaylist(t *testing.T) {
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := &Config{}
+	cfg.Init()
+	cfg.Body.ClipGapSeconds = 0
+	sut := NewClipPlaylist(cfg, NewOverlay(cfg))
+	ch := make(chan playlistEvent, 8)
+	sut.OnChanged = func(event string, state PlaylistState) {
+		ch <- playlistEvent{event, state}
+	}
+	clips := []UserClip{
+		{Id: "a", Mp4: "a.mp4", Duration: 30},
+		{Id: "b", Mp4: "b.mp4", Duration: 30},
+		{Id: "c", Mp4: "c.mp4", Duration: 30},
+	}
+
+	sut.Enqueue(clips[:2])
+	waitPlaylistEvent(t, ch, PlaylistClipStarted, 0)
+	if s := sut.Overlay.Playback(); s.Src != "a.mp4" || s.State != PlaybackRequested {
+		t.Errorf("clip not started [%v]", s)
+	}
+	sut.Enqueue(clips[2:])
+	waitPlaylistEvent(t, ch, PlaylistChanged, 0)
+
+	// 別のクリップの終了や2回目の終了は無視する
+	sut.Ended("b.mp4")
+	sut.Ended("a.mp4")
+	sut.Ended("a.mp4")
+	waitPlaylistEvent(t, ch, PlaylistClipEnded, 0)
+	waitPlaylistEvent(t, ch, PlaylistClipStarted, 1)
+
+	sut.Prev()
+	waitPlaylistEvent(t, ch, PlaylistClipStarted, 0)
+	sut.Skip()
+	waitPlaylistEvent(t, ch, PlaylistClipStarted, 0)
+	if s := sut.State(); len(s.Items) != 2 || s.Items[0].Id != "b" {
+		t.Errorf("invalid items after skip [%v]", s.Items)
+	}
+	sut.Next()
+	waitPlaylistEvent(t, ch, PlaylistClipStarted, 1)
+	sut.Next()
+	waitPlaylistEvent(t, ch, PlaylistChanged, -1)
+	if s := sut.State(); s.Playing {
+		t.Errorf("playing after the last clip")
+	}
+
+	sut.Clear()
+	waitPlaylistEvent(t, ch, PlaylistChanged, -1)
+	if s := sut.State(); len(s.Items) != 0 {
+		t.Errorf("items remain [%v]", s.Items)
+	}
+	select {
+	case e := <-ch:
+		t.Errorf("unexpected event [%v]", e)
+	default:
+	}
+}
+
+func TestClipPlaylist_PlaybackCallback(t *testing.T) {
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := &Config{}
+	cfg.Init()
+	sut := NewClipPlaylist(cfg, NewOverlay(cfg))
+	// 再生状況の通知からプレイリストを触ってもロックが重ならない
+	seen := make(chan PlaylistState, 8)
+	sut.Overlay.OnPlayback = func(s PlaybackState) {
+		seen <- sut.State()
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sut.Enqueue([]UserClip{{Id: "a", Mp4: "a.mp4", Duration: 30}})
+		sut.Clear()
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("deadlock in playback callback")
+	}
+	if s := <-seen; !s.Playing || s.Current != 0 {
+		t.Errorf("invalid state on start [%v]", s)
+	}
+	if s := <-seen; s.Playing || len(s.Items) != 0 {
+		t.Errorf("invalid state on clear [%v]", s)
+	}
+}
@@ -0,0 +1,145 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Helixで使う引き換えの状態(EventSubでは小文字で届く)
+const (
+	RedemptionUnfulfilled = "UNFULFILLED"
+	RedemptionFulfilled   = "FULFILLED"
+	RedemptionCanceled    = "CANCELED"
+)
+
+var ErrRedemptionNotFound = errors.New("redemption not found")
+
+type Redemption struct {
+	Id          string
+	RewardId    string
+	RewardTitle string
+	Cost        int
+	UserName    UserName
+	UserLogin   string
+	UserInput   string
+	Status      string
+	RedeemedAt  time.Time
+}
+
+type RedemptionCallback func([]Redemption)
+
+// 未処理(UNFULFILLED)の引き換えを届いた順に保持する
+// EventSubの受信goroutineとフロントエンドから触るのでmuで保護する
+type RedemptionQueue struct {
+	mu        sync.Mutex
+	Items     []Redemption
+	OnChanged RedemptionCallback
+}
+
+func NewRedemptionQueue() *RedemptionQueue {
+	return &RedemptionQueue{Items: []Redemption{}}
+}
+
+func normalizeRedemptionStatus(status string) string {
+	return strings.ToUpper(status)
+}
+
+func (q *RedemptionQueue) notify() {
+	if q.OnChanged != nil {
+		q.OnChanged(slices.Clone(q.Items))
+	}
+}
+
+// 未処理のものだけ積む(キューをスキップする報酬は最初からFULFILLEDで届く)
+func (q *RedemptionQueue) Add(r Redemption) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	r.Status = normalizeRedemptionStatus(r.Status)
+	if r.Status != RedemptionUnfulfilled {
+		return
+	}
+	if slices.ContainsFunc(q.Items, func(v Redemption) bool { return v.Id == r.Id }) {
+		return
+	}
+	q.Items = append(q.Items, r)
+	q.notify()
+}
+
+// redemption.update や fulfill/cancel の結果を反映する
+// 未処理でなくなったものはキューから外す
+func (q *RedemptionQueue) Update(id, status string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if normalizeRedemptionStatus(status) == RedemptionUnfulfilled {
+		return
+	}
+	n := len(q.Items)
+	q.Items = slices.DeleteFunc(q.Items, func(v Redemption) bool { return v.Id == id })
+	if len(q.Items) != n {
+		q.notify()
+	}
+}
+
+func (q *RedemptionQueue) Find(id string) (Redemption, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, v := range q.Items {
+		if v.Id == id {
+			return v, true
+		}
+	}
+	return Redemption{}, false
+}
+
+func (q *RedemptionQueue) List() []Redemption {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return slices.Clone(q.Items)
+}
+
+func toRedemption(e *EventFormatChannelPointsCustomRewardRedemptionAdd) Redemption {
+	at, _ := time.Parse(time.RFC3339, e.RedeemedAt)
+	return Redemption{
+		Id:          e.Id,
+		RewardId:    e.Reward.Id,
+		RewardTitle: e.Reward.Title,
+		Cost:        e.Reward.Cost,
+		UserName:    UserName(e.UserName),
+		UserLogin:   e.UserLogin,
+		UserInput:   e.UserInput,
+		Status:      e.Status,
+		RedeemedAt:  at,
+	}
+}
+
+func (c *BackendContext) ListRedemptions() []Redemption {
+	return c.Redemptions.List()
+}
+
+var updateRedemptionStatus = UpdateRedemptionStatus
+
+// このツールのClient-Idで作った報酬の引き換えしか変更できない(403になる)
+func (c *BackendContext) setRedemptionStatus(id, status string) error {
+	r, exists := c.Redemptions.Find(id)
+	if !exists {
+		return ErrRedemptionNotFound
+	}
+	if err := updateRedemptionStatus(c.Config, c.Config.TargetUserId, r.RewardId, r.Id, status); err != nil {
+		return fmt.Errorf("%v[%v]: %w", r.RewardTitle, r.UserName, err)
+	}
+	c.Redemptions.Update(id, status)
+	return nil
+}
+
+func (c *BackendContext) FulfillRedemption(id string) error {
+	return c.setRedemptionStatus(id, RedemptionFulfilled)
+}
+
+// キャンセルするとポイントは返却される
+func (c *BackendContext) CancelRedemption(id string) error {
+	return c.setRedemptionStatus(id, RedemptionCanceled)
+}
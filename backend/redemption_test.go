@@ -0,0 +1,41 @@
+package backend
+
+import (
+	"testing"
+)
+
+func TestRedemptionQueue(t *testing.T) {
+	sut := NewRedemptionQueue()
+	changed := 0
+	sut.OnChanged = func(l []Redemption) {
+		changed += 1
+	}
+	sut.Add(Redemption{Id: "1", RewardTitle: "hydrate", Status: "unfulfilled"})
+	sut.Add(Redemption{Id: "2", RewardTitle: "song", Status: "unfulfilled"})
+	sut.Add(Redemption{Id: "3", RewardTitle: "skip", Status: "fulfilled"})
+	sut.Add(Redemption{Id: "1", RewardTitle: "hydrate", Status: "unfulfilled"})
+
+	l := sut.List()
+	if len(l) != 2 || l[0].Id != "1" || l[1].Id != "2" || l[0].Status != RedemptionUnfulfilled {
+		t.Errorf("invalid queue [%v]", l)
+	}
+	if changed != 2 {
+		t.Errorf("invalid notify count [%v]", changed)
+	}
+
+	sut.Update("1", "unfulfilled")
+	sut.Update("1", "canceled")
+	sut.Update("unknown", "fulfilled")
+	if l := sut.List(); len(l) != 1 || l[0].Id != "2" {
+		t.Errorf("invalid queue after update [%v]", l)
+	}
+	if changed != 3 {
+		t.Errorf("invalid notify count after update [%v]", changed)
+	}
+	if _, exists := sut.Find("1"); exists {
+		t.Errorf("removed redemption found")
+	}
+	if r, exists := sut.Find("2"); !exists || r.RewardTitle != "song" {
+		t.Errorf("redemption not found [%v]", r)
+	}
+}
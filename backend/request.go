@@ -34,6 +34,7 @@ func issueRequest(r *http.Request, debug bool) ([]byte, int, error) {
 	switch resp.StatusCode {
 	case 200:
 	case 202:
+	case 204:
 	case 401:
 		logger.Error("issueRequest", slog.Any("msg", "401 error"), slog.Any("Status", resp.Status), slog.Any("URL", r.URL), slog.Any("RawRet", string(byteArray)))
 		return nil, resp.StatusCode, errors.New(RequestErrorBy401)
@@ -190,34 +191,34 @@ func RefreshAccessToken(cfg *Config, refreshToken string) (string, string, error
 }
 
 // https://dev.twitch.tv/docs/authentication/validate-tokens/
-func ValidateAccessToken(cfg *Config) (bool, int, string, string, error) {
+func ValidateAccessToken(cfg *Config) (bool, int, string, string, []string, error) {
 	req, err := http.NewRequest("GET", "https://id.twitch.tv/oauth2/validate", nil)
 	if err != nil {
 		logger.Error("ValidateAccessToken::http.NewRequest", slog.Any("ERR", err.Error()))
-		return false, 0, "", "", err
+		return false, 0, "", "", nil, err
 	}
 	req.Header.Set("Authorization", fmt.Sprintf("OAuth %s", cfg.AuthCode()))
 
 	byteArray, statusCode, err := issueRequest(req, cfg.IsDebug())
 	if statusCode == 401 {
 		logger.Info("ValidateAccessToken::401", slog.Any("raw", string(byteArray)))
-		return false, 0, "", "", nil
+		return false, 0, "", "", nil, nil
 	}
 	if err != nil {
 		logger.Error("ValidateAccessToken::Error", slog.Any("ERR", err.Error()))
-		return false, 0, "", "", err
+		return false, 0, "", "", nil, err
 	}
 
 	r := &ValidateTokenResponce{}
 	err = json.Unmarshal(byteArray, &r)
 	if err != nil {
 		logger.Error("json.Unmarshal", slog.Any("ERR", err.Error()))
-		return false, 0, "", "", err
+		return false, 0, "", "", nil, err
 	}
 	if cfg.IsDebug() {
 		logger.Info("ValidateAccessToken", slog.Any("raw", r))
 	}
-	return statusCode == 200, r.ExpiresIn, r.Login, r.UserId, nil
+	return statusCode == 200, r.ExpiresIn, r.Login, r.UserId, r.Scopes, nil
 }
 
 func ReferTargetUserId(cfg *Config) (string, int, error) {
@@ -257,6 +258,29 @@ func ReferUserClipsByDate(cfg *Config, userId string, featured bool, date *time.
 	return issueGetClipRequest(cfg, url)
 }
 
+// 配信中なら配信の開始日時を返す。配信していなければゼロ値
+// https://dev.twitch.tv/docs/api/reference/#get-streams
+func ReferStreamStartedAt(cfg *Config, userId string) (time.Time, error) {
+	url := fmt.Sprintf("https://api.twitch.tv/helix/streams?user_id=%v", userId)
+	raw, _, err := issueEventSubRequest(cfg, "GET", url, nil)
+	if err != nil {
+		logger.Error("Eventsub Request", slog.Any("ERR", err.Error()))
+		return time.Time{}, err
+	}
+	r := &GetStreamsApiResponce{}
+	err = json.Unmarshal(raw, &r)
+	if err != nil {
+		logger.Error("json.Unmarshal", slog.Any("ERR", err.Error()))
+		return time.Time{}, err
+	}
+	for _, s := range r.Data {
+		if s.Type == "live" {
+			return time.Parse(time.RFC3339, s.StartedAt)
+		}
+	}
+	return time.Time{}, nil
+}
+
 func ReferUserChannelRewards(cfg *Config, userId string) (*GetCustomRewardResponce, error) {
 	url := fmt.Sprintf("https://api.twitch.tv/helix/channel_points/custom_rewards?broadcaster_id=%v", userId)
 	req, err := http.NewRequest("GET", url, nil)
@@ -282,3 +306,87 @@ func ReferUserChannelRewards(cfg *Config, userId string) (*GetCustomRewardRespon
 	}
 	return r, nil
 }
+
+// userId が空ならグローバルのバッジ
+func ReferChatBadges(cfg *Config, userId string) (*GetChatBadgesResponce, error) {
+	url := "https://api.twitch.tv/helix/chat/badges/global"
+	if userId != "" {
+		url = fmt.Sprintf("https://api.twitch.tv/helix/chat/badges?broadcaster_id=%v", userId)
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		logger.Error("ReferChatBadges::http.NewRequest", slog.Any("ERR", err.Error()))
+		return nil, err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", cfg.AuthCode()))
+	req.Header.Set("Client-Id", cfg.ClientId())
+
+	raw, _, err := issueRequest(req, cfg.IsDebug())
+	if err != nil {
+		return nil, err
+	}
+
+	r := &GetChatBadgesResponce{}
+	if err := json.Unmarshal(raw, r); err != nil {
+		logger.Error("ReferChatBadges::json.Unmarshal", slog.Any("ERR", err.Error()))
+		return nil, err
+	}
+	return r, nil
+}
+
+func issueCustomRewardRequest(cfg *Config, method, url string, body any) (*GetCustomRewardResponce, error) {
+	var reader io.Reader
+	if body != nil {
+		bin, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(bin)
+	}
+	raw, _, err := issueEventSubRequest(cfg, method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	r := &GetCustomRewardResponce{}
+	if len(raw) == 0 {
+		return r, nil
+	}
+	err = json.Unmarshal(raw, &r)
+	if err != nil {
+		logger.Error("json.Unmarshal", slog.Any("ERR", err.Error()))
+		return nil, err
+	}
+	return r, nil
+}
+
+// 以下の更新系はこのツールのClient-Idで作った報酬しか操作できない(403になる)
+// https://dev.twitch.tv/docs/api/reference/#create-custom-rewards
+func CreateCustomReward(cfg *Config, userId string, body *CustomRewardBody) (*GetCustomRewardResponce, error) {
+	url := fmt.Sprintf("https://api.twitch.tv/helix/channel_points/custom_rewards?broadcaster_id=%v", userId)
+	return issueCustomRewardRequest(cfg, "POST", url, body)
+}
+
+// bodyは変更するフィールドだけでよい
+// https://dev.twitch.tv/docs/api/reference/#update-custom-reward
+func UpdateCustomReward(cfg *Config, userId, rewardId string, body any) (*GetCustomRewardResponce, error) {
+	url := fmt.Sprintf("https://api.twitch.tv/helix/channel_points/custom_rewards?broadcaster_id=%v&id=%v", userId, rewardId)
+	return issueCustomRewardRequest(cfg, "PATCH", url, body)
+}
+
+// https://dev.twitch.tv/docs/api/reference/#delete-custom-reward
+func DeleteCustomReward(cfg *Config, userId, rewardId string) error {
+	url := fmt.Sprintf("https://api.twitch.tv/helix/channel_points/custom_rewards?broadcaster_id=%v&id=%v", userId, rewardId)
+	_, err := issueCustomRewardRequest(cfg, "DELETE", url, nil)
+	return err
+}
+
+// https://dev.twitch.tv/docs/api/reference/#update-redemption-status
+func UpdateRedemptionStatus(cfg *Config, userId, rewardId, redemptionId, status string) error {
+	url := fmt.Sprintf(
+		"https://api.twitch.tv/helix/channel_points/custom_rewards/redemptions?broadcaster_id=%v&reward_id=%v&id=%v",
+		userId, rewardId, redemptionId,
+	)
+	bin, _ := json.Marshal(map[string]string{"status": status})
+	_, _, err := issueEventSubRequest(cfg, "PATCH", url, bytes.NewReader(bin))
+	return err
+}
@@ -0,0 +1,162 @@
+package backend
+
+import (
+	"errors"
+	"log/slog"
+)
+
+// 配信開始で有効化、配信終了で一時停止するチャネポ報酬のまとまり
+// Rewardsには報酬のタイトルかIDを書く
+type RewardSet struct {
+	Name    string   `yaml:"NAME"`
+	Enabled bool     `yaml:"ENABLED"`
+	Rewards []string `yaml:"REWARDS"`
+}
+
+var (
+	ErrRewardNotFound    = errors.New("reward not found")
+	ErrRewardSetNotFound = errors.New("reward set not found")
+)
+
+func toChannelPoints(raw *GetCustomRewardResponce) []ChannelPoint {
+	ret := []ChannelPoint{}
+	if raw == nil {
+		return ret
+	}
+	for _, r := range raw.Data {
+		ret = append(ret, ChannelPoint{
+			Id:                    r.Id,
+			Title:                 r.Title,
+			Cost:                  r.Cost,
+			Enabled:               r.IsEnabled,
+			Paused:                r.IsPaused,
+			Prompt:                r.Prompt,
+			BackgroundColor:       r.BackgroundColor,
+			UserInputRequired:     r.IsUserInputRequired,
+			MaxPerStream:          int(r.MaxPerStreamSetting.MaxPerStream),
+			MaxPerUserPerStream:   int(r.MaxPerUserPerStreamSetting.MaxPerUserPerStream),
+			GlobalCooldownSeconds: int(r.GlobalCooldownSetting.GlobalCooldownSeconds),
+			SkipRequestQueue:      r.ShouldRedemptionsSkipRequestQueue,
+		})
+	}
+	return ret
+}
+
+func toCustomRewardBody(p *ChannelPoint) *CustomRewardBody {
+	return &CustomRewardBody{
+		Title:                             p.Title,
+		Cost:                              p.Cost,
+		Prompt:                            p.Prompt,
+		IsEnabled:                         p.Enabled,
+		BackgroundColor:                   p.BackgroundColor,
+		IsUserInputRequired:               p.UserInputRequired,
+		IsMaxPerStreamEnabled:             p.MaxPerStream > 0,
+		MaxPerStream:                      p.MaxPerStream,
+		IsMaxPerUserPerStreamEnabled:      p.MaxPerUserPerStream > 0,
+		MaxPerUserPerStream:               p.MaxPerUserPerStream,
+		IsGlobalCooldownEnabled:           p.GlobalCooldownSeconds > 0,
+		GlobalCooldownSeconds:             p.GlobalCooldownSeconds,
+		ShouldRedemptionsSkipRequestQueue: p.SkipRequestQueue,
+	}
+}
+
+func firstChannelPoint(raw *GetCustomRewardResponce) (*ChannelPoint, error) {
+	l := toChannelPoints(raw)
+	if len(l) == 0 {
+		return nil, ErrRewardNotFound
+	}
+	return &l[0], nil
+}
+
+// 有効なセットに含まれる報酬(重複なし、rewardsの順)
+func rewardSetTargets(sets []RewardSet, rewards []ChannelPoint) []ChannelPoint {
+	keys := map[string]struct{}{}
+	for _, s := range sets {
+		if !s.Enabled {
+			continue
+		}
+		for _, k := range s.Rewards {
+			keys[k] = struct{}{}
+		}
+	}
+	ret := []ChannelPoint{}
+	for _, r := range rewards {
+		_, byId := keys[r.Id]
+		_, byTitle := keys[r.Title]
+		if byId || byTitle {
+			ret = append(ret, r)
+		}
+	}
+	return ret
+}
+
+func (c *BackendContext) CreateChannelReward(p *ChannelPoint) (*ChannelPoint, error) {
+	raw, err := CreateCustomReward(c.Config, c.Config.TargetUserId, toCustomRewardBody(p))
+	if err != nil {
+		return nil, err
+	}
+	return firstChannelPoint(raw)
+}
+
+// p.Idの報酬をpの内容で置き換える
+func (c *BackendContext) UpdateChannelReward(p *ChannelPoint) (*ChannelPoint, error) {
+	raw, err := UpdateCustomReward(c.Config, c.Config.TargetUserId, p.Id, toCustomRewardBody(p))
+	if err != nil {
+		return nil, err
+	}
+	return firstChannelPoint(raw)
+}
+
+func (c *BackendContext) DeleteChannelReward(id string) error {
+	return DeleteCustomReward(c.Config, c.Config.TargetUserId, id)
+}
+
+func (c *BackendContext) PauseChannelReward(id string, paused bool) error {
+	_, err := UpdateCustomReward(c.Config, c.Config.TargetUserId, id, map[string]bool{"is_paused": paused})
+	return err
+}
+
+func (c *BackendContext) EnableChannelReward(id string, enabled bool) error {
+	_, err := UpdateCustomReward(c.Config, c.Config.TargetUserId, id, map[string]bool{"is_enabled": enabled})
+	return err
+}
+
+func rewardSetBody(online bool) map[string]bool {
+	if online {
+		return map[string]bool{"is_enabled": true, "is_paused": false}
+	}
+	return map[string]bool{"is_paused": true}
+}
+
+// 失敗した報酬があっても残りは続ける(最後のエラーを返す)
+func (c *BackendContext) applyRewardSets(sets []RewardSet, online bool) error {
+	var ret error
+	for _, r := range rewardSetTargets(sets, c.ListChannelRewards()) {
+		if _, err := UpdateCustomReward(c.Config, c.Config.TargetUserId, r.Id, rewardSetBody(online)); err != nil {
+			logger.Error("applyRewardSets", slog.Any("reward", r.Title), slog.Any("ERR", err.Error()))
+			ret = err
+		}
+	}
+	return ret
+}
+
+// 配信開始時は有効化して一時停止を解除、配信終了時は一時停止する
+func (c *BackendContext) ApplyRewardSets(online bool) {
+	sets := c.Config.RewardSets()
+	// ローカルテスト中は本物の報酬を触らない
+	if len(sets) == 0 || c.Config.IsLocalTest() {
+		return
+	}
+	c.applyRewardSets(sets, online)
+}
+
+// 名前で指定したセットを手動で切り替える(ENABLEDに関係なく)
+func (c *BackendContext) ApplyRewardSet(name string, online bool) error {
+	for _, s := range c.Config.RewardSets() {
+		if s.Name == name {
+			s.Enabled = true
+			return c.applyRewardSets([]RewardSet{s}, online)
+		}
+	}
+	return ErrRewardSetNotFound
+}
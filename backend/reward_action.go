@@ -0,0 +1,95 @@
+package backend
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// チャネポ報酬が引き換えられたときに実行する内容
+// 指定された項目だけ実行する(SOUND -> MEDIA -> OBS_SCENE -> OBS_SOURCE の順)
+type RewardAction struct {
+	Reward         string `yaml:"REWARD"` // 報酬のタイトルかID
+	SoundFile      string `yaml:"SOUND"`
+	MediaFile      string `yaml:"MEDIA"`
+	ObsScene       string `yaml:"OBS_SCENE"`
+	ObsSource      string `yaml:"OBS_SOURCE"`
+	ObsSourceScene string `yaml:"OBS_SOURCE_SCENE"` // 空なら今のシーン
+	Seconds        int    `yaml:"SECONDS"`          // シーン/ソースを戻すまでの秒数(0なら戻さない)
+	AutoFulfill    bool   `yaml:"AUTO_FULFILL"`     // 全部成功したら完了にする
+	RefundOnError  bool   `yaml:"REFUND_ON_ERROR"`  // 失敗したらキャンセルしてポイントを返す
+}
+
+func findRewardActions(actions []RewardAction, r *Redemption) []RewardAction {
+	ret := []RewardAction{}
+	for _, a := range actions {
+		if a.Reward == r.RewardId || a.Reward == r.RewardTitle {
+			ret = append(ret, a)
+		}
+	}
+	return ret
+}
+
+// 音の再生は終わるまで待つので、同時に鳴らす指定があっても順番に鳴らす
+var soundLock sync.Mutex
+
+func (c *BackendContext) runRewardAction(a *RewardAction) error {
+	if a.SoundFile != "" {
+		soundLock.Lock()
+		err := playSoundFile(a.SoundFile)
+		soundLock.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	if a.MediaFile != "" {
+		url := c.Overlay.PublishMedia(a.MediaFile)
+		if err := c.Overlay.TryStartClip(url); err != nil {
+			return err
+		}
+	}
+	if a.ObsScene != "" {
+		if err := SwitchObsScene(c.Config, a.ObsScene, a.Seconds); err != nil {
+			return err
+		}
+	}
+	if a.ObsSource != "" {
+		if err := ShowObsSource(c.Config, a.ObsSourceScene, a.ObsSource, a.Seconds); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 受信処理を止めないように別goroutineで実行する
+func (c *BackendContext) RunRewardActions(r Redemption) {
+	actions := findRewardActions(c.Config.RewardActions(), &r)
+	if len(actions) == 0 {
+		return
+	}
+	go c.runRewardActions(&r, actions)
+}
+
+// 全部実行してから、全部成功なら完了、どれか失敗して返却指定があればキャンセルを一度だけ行う
+func (c *BackendContext) runRewardActions(r *Redemption, actions []RewardAction) {
+	failed, fulfill, refund := false, false, false
+	for _, a := range actions {
+		if err := c.runRewardAction(&a); err != nil {
+			logger.Error("RunRewardActions", slog.Any("reward", r.RewardTitle), slog.Any("ERR", err.Error()))
+			failed = true
+		}
+		fulfill = fulfill || a.AutoFulfill
+		refund = refund || a.RefundOnError
+	}
+	var err error
+	switch {
+	case failed && refund:
+		err = c.CancelRedemption(r.Id)
+	case !failed && fulfill:
+		err = c.FulfillRedemption(r.Id)
+	default:
+		return
+	}
+	if err != nil {
+		logger.Error("RunRewardActions::UpdateStatus", slog.Any("reward", r.RewardTitle), slog.Any("ERR", err.Error()))
+	}
+}
@@ -0,0 +1,125 @@
+package backend
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRewardSetTargets(t *testing.T) {
+	rewards := []ChannelPoint{
+		{Id: "id1", Title: "hydrate"},
+		{Id: "id2", Title: "song"},
+		{Id: "id3", Title: "stretch"},
+	}
+	sets := []RewardSet{
+		{Name: "game", Enabled: true, Rewards: []string{"hydrate", "id2"}},
+		{Name: "song", Enabled: true, Rewards: []string{"song"}},
+		{Name: "off", Enabled: false, Rewards: []string{"stretch"}},
+	}
+	ret := rewardSetTargets(sets, rewards)
+	if len(ret) != 2 || ret[0].Id != "id1" || ret[1].Id != "id2" {
+		t.Errorf("invalid targets [%v]", ret)
+	}
+	if ret := rewardSetTargets(nil, rewards); len(ret) != 0 {
+		t.Errorf("targets without sets [%v]", ret)
+	}
+}
+
+func TestToCustomRewardBody(t *testing.T) {
+	p := &ChannelPoint{Title: "hydrate", Cost: 100, Enabled: true, MaxPerStream: 3}
+	bin, err := json.Marshal(toCustomRewardBody(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := string(bin)
+	for _, want := range []string{
+		`"is_max_per_stream_enabled":true`,
+		`"max_per_stream":3`,
+		`"is_global_cooldown_enabled":false`,
+	} {
+		if !strings.Contains(raw, want) {
+			t.Errorf("%v not in [%v]", want, raw)
+		}
+	}
+	if strings.Contains(raw, "global_cooldown_seconds") {
+		t.Errorf("unused limit sent [%v]", raw)
+	}
+}
+
+func TestFindRewardActions(t *testing.T) {
+	actions := []RewardAction{
+		{Reward: "hydrate", SoundFile: "a.wav"},
+		{Reward: "id2", ObsScene: "scene"},
+		{Reward: "other"},
+	}
+	ret := findRewardActions(actions, &Redemption{RewardId: "id2", RewardTitle: "hydrate"})
+	if len(ret) != 2 || ret[0].SoundFile != "a.wav" || ret[1].ObsScene != "scene" {
+		t.Errorf("invalid actions [%v]", ret)
+	}
+	if ret := findRewardActions(actions, &Redemption{RewardId: "id3", RewardTitle: "song"}); len(ret) != 0 {
+		t.Errorf("unexpected actions [%v]", ret)
+	}
+}
+
+func TestRunRewardActions(t *testing.T) {
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	updated := []string{}
+	updateRedemptionStatus = func(cfg *Config, userId, rewardId, redemptionId, status string) error {
+		updated = append(updated, redemptionId+":"+status)
+		return nil
+	}
+	defer func() { updateRedemptionStatus = UpdateRedemptionStatus }()
+	cfg := &Config{}
+	cfg.Init()
+	sut := &BackendContext{Config: cfg, Redemptions: NewRedemptionQueue()}
+	missing := filepath.Join(t.TempDir(), "missing.wav")
+
+	for _, tt := range []struct {
+		id      string
+		actions []RewardAction
+		want    []string
+	}{
+		// 先頭の AUTO_FULFILL で止まらずに後ろも実行する
+		{"ok", []RewardAction{{AutoFulfill: true}, {}}, []string{"ok:" + RedemptionFulfilled}},
+		{"fail", []RewardAction{{AutoFulfill: true}, {SoundFile: missing}}, []string{}},
+		{"refund", []RewardAction{{AutoFulfill: true}, {SoundFile: missing, RefundOnError: true}}, []string{"refund:" + RedemptionCanceled}},
+		{"none", []RewardAction{{}, {}}, []string{}},
+	} {
+		updated = []string{}
+		r := Redemption{Id: tt.id, Status: RedemptionUnfulfilled}
+		sut.Redemptions.Add(r)
+		sut.runRewardActions(&r, tt.actions)
+		if !slices.Equal(updated, tt.want) {
+			t.Errorf("%v: invalid status updates [%v]", tt.id, updated)
+		}
+	}
+}
+
+func TestOverlayMedia(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.txt")
+	os.WriteFile(path, []byte("media"), 0644)
+	sut := NewOverlay(nil)
+	url := sut.PublishMedia(path)
+
+	w := httptest.NewRecorder()
+	sut.OnMedia(w, httptest.NewRequest("GET", url, nil))
+	if w.Code != 200 || w.Body.String() != "media" {
+		t.Errorf("invalid media responce [%v:%v]", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	sut.OnMedia(w, httptest.NewRequest("GET", "/media/unknown.txt", nil))
+	if w.Code != 404 {
+		t.Errorf("unpublished media served [%v]", w.Code)
+	}
+	if err := sut.TryStartClip(url); err != ErrOverlayNotConnected {
+		t.Errorf("no error without overlay [%v]", err)
+	}
+}
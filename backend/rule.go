@@ -10,3 +10,34 @@ func ConvertThumbnailToMp4Url(thumbnailUrl string) string {
 	r := regexp.MustCompile("-preview-.*")
 	return r.ReplaceAllString(thumbnailUrl, ".mp4")
 }
+
+// count が0以下なら1本
+func fetchUserClips(cfg *Config, userId string, count int) ([]UserClip, error) {
+	_, clips, err := ReferUserClips(cfg, userId)
+	if err != nil {
+		return nil, err
+	}
+	if count <= 0 {
+		count = 1
+	}
+	ret := []UserClip{}
+	for _, clip := range clips.Data {
+		if len(ret) >= count {
+			break
+		}
+		ret = append(ret, toUserClip(&clip))
+	}
+	return ret, nil
+}
+
+func toUserClip(c *ClipData) UserClip {
+	return UserClip{
+		Id:        c.Id,
+		Url:       c.Url,
+		Thumbnail: c.ThumbnailUrl,
+		Title:     c.Title,
+		ViewCount: c.ViewCount,
+		Duration:  c.Duration,
+		Mp4:       ConvertThumbnailToMp4Url(c.ThumbnailUrl),
+	}
+}
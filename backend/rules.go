@@ -0,0 +1,330 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// イベントを受けたときに実行する処理の定義
+// EVENT はサブスクリプションタイプ(channel.cheer など)で、空なら全イベントが対象
+// MATCH は全部満たしたときだけ ACTIONS を上から順に実行する
+type Rule struct {
+	Name    string          `yaml:"NAME"`
+	Event   string          `yaml:"EVENT"`
+	Match   []RuleCondition `yaml:"MATCH"`
+	Actions []RuleAction    `yaml:"ACTIONS"`
+}
+
+// FIELD は payload.event の中をドット区切りで指定する(例: bits, raid.viewer_count)
+// 指定された項目だけ判定する
+type RuleCondition struct {
+	Field  string   `yaml:"FIELD"`
+	Min    *float64 `yaml:"MIN,omitempty"`
+	Max    *float64 `yaml:"MAX,omitempty"`
+	Equals string   `yaml:"EQUALS"`
+	In     []string `yaml:"IN"` // ユーザ名のリストなど(大文字小文字は区別しない)
+	Regex  string   `yaml:"REGEX"`
+
+	re *regexp.Regexp // 設定の読み込み時に compileRules で作る
+}
+
+// TEXT は text/template で payload.event の項目を埋め込める(例: {{.user_name}})
+type RuleAction struct {
+	Type    string `yaml:"TYPE"` // RuleActionTable のキー
+	File    string `yaml:"FILE"`
+	Text    string `yaml:"TEXT"`
+	Scene   string `yaml:"SCENE"`
+	Source  string `yaml:"SOURCE"`
+	Seconds int    `yaml:"SECONDS"` // シーン/ソースを戻すまでの秒数(0なら戻さない)
+	Field   string `yaml:"FIELD"`   // raid_clips でレイド元のユーザIDを取る項目
+	Count   int    `yaml:"COUNT"`   // raid_clips で再生する本数
+}
+
+type RuleEvent struct {
+	Type  string
+	Event map[string]any
+}
+
+type RuleActionFunc func(c *BackendContext, a *RuleAction, e *RuleEvent) error
+
+const (
+	RuleActionLog       = "log"
+	RuleActionSound     = "sound"
+	RuleActionMedia     = "media"
+	RuleActionAlert     = "alert"
+	RuleActionObsScene  = "obs_scene"
+	RuleActionObsSource = "obs_source"
+	RuleActionRaidClips = "raid_clips"
+
+	ruleRaidUserIdDefault = "raid.user_id"
+)
+
+var ErrRuleActionUnknown = errors.New("unknown rule action")
+
+var RuleActionTable = map[string]RuleActionFunc{
+	RuleActionLog:       ruleActionLog,
+	RuleActionSound:     ruleActionSound,
+	RuleActionMedia:     ruleActionMedia,
+	RuleActionAlert:     ruleActionAlert,
+	RuleActionObsScene:  ruleActionObsScene,
+	RuleActionObsSource: ruleActionObsSource,
+	RuleActionRaidClips: ruleActionRaidClips,
+}
+
+func parseRuleEvent(subscType string, raw []byte) (*RuleEvent, error) {
+	v := struct {
+		Payload struct {
+			Event map[string]any `json:"event"`
+		} `json:"payload"`
+	}{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+	if v.Payload.Event == nil {
+		v.Payload.Event = map[string]any{}
+	}
+	return &RuleEvent{Type: subscType, Event: v.Payload.Event}, nil
+}
+
+func (e *RuleEvent) Lookup(path string) (any, bool) {
+	var cur any = e.Event
+	for _, k := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[k]; !ok {
+			return nil, false
+		}
+	}
+	return cur, cur != nil
+}
+
+func (e *RuleEvent) Text(path string) string {
+	v, ok := e.Lookup(path)
+	if !ok {
+		return ""
+	}
+	switch t := v.(type) {
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(t)
+	}
+	bin, _ := json.Marshal(v)
+	return string(bin)
+}
+
+// 数値の項目は文字列で来ることもあるので両方受け付ける
+func (e *RuleEvent) Number(path string) (float64, bool) {
+	v, ok := e.Lookup(path)
+	if !ok {
+		return 0, false
+	}
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case string:
+		f, err := strconv.ParseFloat(t, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func (c *RuleCondition) Matches(e *RuleEvent) bool {
+	if _, exists := e.Lookup(c.Field); !exists {
+		return false
+	}
+	if c.Min != nil || c.Max != nil {
+		n, ok := e.Number(c.Field)
+		if !ok {
+			return false
+		}
+		if c.Min != nil && n < *c.Min {
+			return false
+		}
+		if c.Max != nil && n > *c.Max {
+			return false
+		}
+	}
+	text := e.Text(c.Field)
+	if c.Equals != "" && text != c.Equals {
+		return false
+	}
+	if len(c.In) > 0 {
+		found := false
+		for _, v := range c.In {
+			if strings.EqualFold(v, text) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	// コンパイルできなかったパターンは一致しない扱い
+	if c.Regex != "" && (c.re == nil || !c.re.MatchString(text)) {
+		return false
+	}
+	return true
+}
+
+func (r *Rule) Matches(e *RuleEvent) bool {
+	if r.Event != "" && r.Event != e.Type {
+		return false
+	}
+	for i := range r.Match {
+		if !r.Match[i].Matches(e) {
+			return false
+		}
+	}
+	return true
+}
+
+// イベントごとにコンパイルしないよう、読み込んだときに一度だけコンパイルしておく
+// 不正なパターンはまとめてエラーで返す
+func compileRules(rules []Rule) error {
+	errs := []error{}
+	for i := range rules {
+		for j := range rules[i].Match {
+			c := &rules[i].Match[j]
+			c.re = nil
+			if c.Regex == "" {
+				continue
+			}
+			re, err := regexp.Compile(c.Regex)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("rule [%v] REGEX [%v]: %w", rules[i].Name, c.Regex, err))
+				continue
+			}
+			c.re = re
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func findRules(rules []Rule, e *RuleEvent) []Rule {
+	ret := []Rule{}
+	for _, r := range rules {
+		if r.Matches(e) {
+			ret = append(ret, r)
+		}
+	}
+	return ret
+}
+
+func expandRuleText(text string, e *RuleEvent) string {
+	t, err := template.New("rule").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		logger.Error("expandRuleText::Parse", slog.Any("text", text), slog.Any("ERR", err.Error()))
+		return text
+	}
+	buf := &bytes.Buffer{}
+	if err := t.Execute(buf, e.Event); err != nil {
+		logger.Error("expandRuleText::Execute", slog.Any("text", text), slog.Any("ERR", err.Error()))
+		return text
+	}
+	return strings.ReplaceAll(buf.String(), "<no value>", "")
+}
+
+func ruleActionLog(_ *BackendContext, a *RuleAction, e *RuleEvent) error {
+	logger.Info("RuleAction:log", slog.Any("type", e.Type), slog.Any("text", expandRuleText(a.Text, e)))
+	return nil
+}
+
+func ruleActionSound(_ *BackendContext, a *RuleAction, _ *RuleEvent) error {
+	soundLock.Lock()
+	defer soundLock.Unlock()
+	return playSoundFile(a.File)
+}
+
+func ruleActionMedia(c *BackendContext, a *RuleAction, _ *RuleEvent) error {
+	return c.Overlay.TryStartClip(c.Overlay.PublishMedia(a.File))
+}
+
+// アラートボックスの順番待ちに入れる。見た目は ALERTS の rule で変えられる
+func ruleActionAlert(c *BackendContext, a *RuleAction, e *RuleEvent) error {
+	return c.TryPushAlert(Alert{Event: AlertRule, User: e.Text("user_name"), Message: expandRuleText(a.Text, e)})
+}
+
+func ruleActionObsScene(c *BackendContext, a *RuleAction, _ *RuleEvent) error {
+	return SwitchObsScene(c.Config, a.Scene, a.Seconds)
+}
+
+func ruleActionObsSource(c *BackendContext, a *RuleAction, _ *RuleEvent) error {
+	return ShowObsSource(c.Config, a.Scene, a.Source, a.Seconds)
+}
+
+// レイド元のクリップをプレイリストに入れて順番に再生する
+func ruleActionRaidClips(c *BackendContext, a *RuleAction, e *RuleEvent) error {
+	// チャットやアラートのページしか開いていなければ再生できない
+	if c.Overlay.Hub.Subscribers("on") == 0 {
+		return ErrOverlayNotConnected
+	}
+	field := a.Field
+	if field == "" {
+		field = ruleRaidUserIdDefault
+	}
+	userId := e.Text(field)
+	if userId == "" {
+		return fmt.Errorf("raid user id not found in [%v]", field)
+	}
+	queue, err := fetchUserClips(c.Config, userId, a.Count)
+	if err != nil {
+		return err
+	}
+	c.Playlist.Enqueue(queue)
+	return nil
+}
+
+func (c *BackendContext) runRule(r *Rule, e *RuleEvent) {
+	for i := range r.Actions {
+		a := &r.Actions[i]
+		f, exists := RuleActionTable[a.Type]
+		if !exists {
+			logger.Error("RunRules", slog.Any("rule", r.Name), slog.Any("action", a.Type), slog.Any("ERR", ErrRuleActionUnknown.Error()))
+			return
+		}
+		if err := f(c, a, e); err != nil {
+			logger.Error("RunRules", slog.Any("rule", r.Name), slog.Any("action", a.Type), slog.Any("ERR", err.Error()))
+			return
+		}
+	}
+}
+
+// 各ハンドラの後に呼ばれる
+// ドライランでは一致したルールをログに出すだけ
+func (c *BackendContext) RunRules(subscType string, raw []byte) {
+	rules := c.Config.Rules()
+	if len(rules) == 0 {
+		return
+	}
+	e, err := parseRuleEvent(subscType, raw)
+	if err != nil {
+		logger.Error("RunRules::parseRuleEvent", slog.Any("ERR", err.Error()))
+		return
+	}
+	for _, r := range findRules(rules, e) {
+		r := r
+		if c.Config.IsRulesDryRun() {
+			actions := []string{}
+			for _, a := range r.Actions {
+				actions = append(actions, a.Type)
+			}
+			logger.Info("RunRules:DryRun", slog.Any("rule", r.Name), slog.Any("type", subscType), slog.Any("actions", actions))
+			continue
+		}
+		// 受信処理を止めないように別goroutineで実行する
+		go c.runRule(&r, e)
+	}
+}
@@ -0,0 +1,181 @@
+package backend
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const ruleTestConfig = `
+RULES:
+  - NAME: big cheer
+    EVENT: channel.cheer
+    MATCH:
+      - FIELD: bits
+        MIN: 500
+    ACTIONS:
+      - TYPE: sound
+        FILE: cheer.wav
+      - TYPE: alert
+        TEXT: "{{.user_name}} さん {{.bits}} bits"
+  - NAME: big raid
+    EVENT: channel.chat.notification
+    MATCH:
+      - FIELD: notice_type
+        EQUALS: raid
+      - FIELD: raid.viewer_count
+        MIN: 20
+    ACTIONS:
+      - TYPE: raid_clips
+  - NAME: greeting
+    EVENT: channel.chat.message
+    MATCH:
+      - FIELD: chatter_user_login
+        IN: [Alice, bob]
+      - FIELD: message.text
+        REGEX: "^(hi|hello)"
+    ACTIONS:
+      - TYPE: log
+`
+
+func TestRules_Matches(t *testing.T) {
+	cfg, err := loadConfigFrom([]byte(ruleTestConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		subscType string
+		raw       string
+		want      []string
+	}{
+		{"channel.cheer", `{"payload":{"event":{"user_name":"alice","bits":500}}}`, []string{"big cheer"}},
+		{"channel.cheer", `{"payload":{"event":{"user_name":"alice","bits":499}}}`, []string{}},
+		{"channel.follow", `{"payload":{"event":{"user_name":"alice","bits":1000}}}`, []string{}},
+		{"channel.chat.notification", `{"payload":{"event":{"notice_type":"raid","raid":{"user_id":"1","viewer_count":"25"}}}}`, []string{"big raid"}},
+		{"channel.chat.notification", `{"payload":{"event":{"notice_type":"raid","raid":{"user_id":"1","viewer_count":3}}}}`, []string{}},
+		{"channel.chat.notification", `{"payload":{"event":{"notice_type":"sub"}}}`, []string{}},
+		{"channel.chat.message", `{"payload":{"event":{"chatter_user_login":"alice","message":{"text":"hello!"}}}}`, []string{"greeting"}},
+		{"channel.chat.message", `{"payload":{"event":{"chatter_user_login":"carol","message":{"text":"hello!"}}}}`, []string{}},
+		{"channel.chat.message", `{"payload":{"event":{"chatter_user_login":"bob","message":{"text":"bye"}}}}`, []string{}},
+	}
+	for _, tt := range tests {
+		e, err := parseRuleEvent(tt.subscType, []byte(tt.raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := findRules(cfg.Rules(), e)
+		if len(got) != len(tt.want) {
+			t.Errorf("%v %v: got [%v] want [%v]", tt.subscType, tt.raw, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i].Name != tt.want[i] {
+				t.Errorf("%v %v: got [%v] want [%v]", tt.subscType, tt.raw, got[i].Name, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestRules_CompileRegex(t *testing.T) {
+	cfg, err := loadConfigFrom([]byte(ruleTestConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.RuleError(); err != nil {
+		t.Fatalf("valid rules rejected [%v]", err)
+	}
+	if c := cfg.Rules()[2].Match[1]; c.re == nil || c.re.String() != c.Regex {
+		t.Errorf("regex not compiled on load [%v]", c.re)
+	}
+
+	raw := ruleTestConfig + `
+  - NAME: broken
+    MATCH:
+      - FIELD: message.text
+        REGEX: "(hi"
+    ACTIONS:
+      - TYPE: log
+`
+	cfg, err = loadConfigFrom([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.RuleError(); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Fatalf("invalid regex not reported [%v]", err)
+	}
+	e, _ := parseRuleEvent("channel.chat.message", []byte(`{"payload":{"event":{"chatter_user_login":"alice","message":{"text":"(hi"}}}}`))
+	if got := findRules(cfg.Rules(), e); len(got) != 0 {
+		t.Errorf("invalid regex matched [%v]", got)
+	}
+
+	// 画面から保存したときもコンパイルし直す
+	body := *cfg.LoadRaw()
+	body.RuleList = slices.Clone(body.RuleList[:3])
+	cfg.UpdateRaw(&body)
+	if err := cfg.RuleError(); err != nil {
+		t.Errorf("error left after update [%v]", err)
+	}
+	e, _ = parseRuleEvent("channel.chat.message", []byte(`{"payload":{"event":{"chatter_user_login":"alice","message":{"text":"hi"}}}}`))
+	if got := findRules(cfg.Rules(), e); len(got) != 1 || got[0].Name != "greeting" {
+		t.Errorf("compiled regex not used [%v]", got)
+	}
+}
+
+func TestRules_ExpandText(t *testing.T) {
+	e, err := parseRuleEvent("channel.cheer", []byte(`{"payload":{"event":{"user_name":"alice","bits":500}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := expandRuleText("{{.user_name}} さん {{.bits}} bits{{.message}}", e); got != "alice さん 500 bits" {
+		t.Errorf("invalid text [%v]", got)
+	}
+}
+
+func TestRules_OverlayActions(t *testing.T) {
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := &Config{}
+	cfg.Init()
+	cfg.Body.AlertList = []AlertStyle{}
+	sut := &BackendContext{Config: cfg, Overlay: NewOverlay(cfg)}
+	e, _ := parseRuleEvent("channel.cheer", []byte(`{"payload":{"event":{"user_name":"alice","bits":500,"raid":{"user_id":"1"}}}}`))
+
+	if err := ruleActionAlert(sut, &RuleAction{Text: "{{.user_name}}"}, e); err != ErrOverlayNotConnected {
+		t.Errorf("alert without overlay [%v]", err)
+	}
+	// チャットのページだけではクリップは再生できない
+	sut.Overlay.Hub.Subscribe([]string{"chat"}, 0)
+	if err := ruleActionRaidClips(sut, &RuleAction{}, e); err != ErrOverlayNotConnected {
+		t.Errorf("raid clips without clip player [%v]", err)
+	}
+
+	// 文字だけの通知ではなくアラートボックスに出す
+	box, _ := sut.Overlay.Hub.Subscribe([]string{AlertOverlayEvent}, 0)
+	if err := ruleActionAlert(sut, &RuleAction{Text: "{{.user_name}} {{.bits}} bits"}, e); err != nil {
+		t.Fatal(err)
+	}
+	m := <-box.ch
+	card := AlertCard{}
+	json.Unmarshal(m.Data, &card)
+	if card.Event != AlertRule || card.User != "alice" || card.Text != "alice 500 bits" || card.Seconds == 0 {
+		t.Errorf("invalid rule alert [%+v]", card)
+	}
+}
+
+func TestRules_DefaultConfigRoundTrip(t *testing.T) {
+	raw, err := yaml.Marshal(DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfigFrom(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Rules()) != 0 || cfg.IsRulesDryRun() {
+		t.Errorf("invalid default rules [%v] [%v]", cfg.Rules(), cfg.IsRulesDryRun())
+	}
+}
@@ -0,0 +1,253 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// scriptsフォルダの*.jsを読み込んで、イベントごとに以下の関数があれば呼ぶ
+//
+//	onNotification(type, event)  event は payload.event
+//	onStreamOnline(event)
+//	onStreamOffline(event)
+//
+// スクリプトからは host オブジェクト経由でだけ外を触れる
+// (ファイルやネットワークには触れない)
+const (
+	ScriptHookNotification  = "onNotification"
+	ScriptHookStreamOnline  = "onStreamOnline"
+	ScriptHookStreamOffline = "onStreamOffline"
+)
+
+var ErrScriptTimeout = errors.New("script timeout")
+
+type script struct {
+	Name string
+	vm   *goja.Runtime
+}
+
+type scriptCall struct {
+	Hook string
+	Args []any
+}
+
+type ScriptEngine struct {
+	mu      sync.Mutex
+	scripts []*script
+	queue   chan scriptCall
+	done    chan struct{}
+	ctx     *BackendContext
+	Timeout time.Duration
+}
+
+func NewScriptEngine(ctx *BackendContext) *ScriptEngine {
+	e := &ScriptEngine{
+		queue:   make(chan scriptCall, ScriptQueueSize),
+		done:    make(chan struct{}),
+		ctx:     ctx,
+		Timeout: ScriptTimeout,
+	}
+	go e.worker()
+	return e
+}
+
+// フォルダが無いときはスクリプトなしで動く
+func (e *ScriptEngine) Load(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.js"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+	scripts := []*script{}
+	errs := []error{}
+	for _, path := range paths {
+		s, err := e.compile(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", filepath.Base(path), err))
+			continue
+		}
+		scripts = append(scripts, s)
+	}
+	e.mu.Lock()
+	e.scripts = scripts
+	e.mu.Unlock()
+	logger.Info("ScriptEngine:Load", slog.Any("dir", dir), slog.Any("scripts", len(scripts)))
+	return errors.Join(errs...)
+}
+
+func (e *ScriptEngine) compile(path string) (*script, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &script{Name: filepath.Base(path), vm: goja.New()}
+	s.vm.SetFieldNameMapper(goja.TagFieldNameMapper("json", true))
+	if err := s.vm.Set("host", e.hostApi(s)); err != nil {
+		return nil, err
+	}
+	// トップレベルの処理も時間制限をかける
+	if _, err := e.run(s, func() (goja.Value, error) {
+		return s.vm.RunScript(s.Name, string(src))
+	}); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (e *ScriptEngine) run(s *script, f func() (goja.Value, error)) (goja.Value, error) {
+	timer := time.AfterFunc(e.Timeout, func() {
+		s.vm.Interrupt(ErrScriptTimeout)
+	})
+	defer func() {
+		timer.Stop()
+		s.vm.ClearInterrupt()
+	}()
+	return f()
+}
+
+func (e *ScriptEngine) call(s *script, hook string, args []any) error {
+	f, ok := goja.AssertFunction(s.vm.Get(hook))
+	if !ok {
+		return nil
+	}
+	values := make([]goja.Value, 0, len(args))
+	for _, a := range args {
+		values = append(values, s.vm.ToValue(a))
+	}
+	_, err := e.run(s, func() (goja.Value, error) {
+		return f(goja.Undefined(), values...)
+	})
+	return err
+}
+
+// スクリプトは1つずつ順番に実行する(goja.Runtimeは並行に使えない)
+func (e *ScriptEngine) worker() {
+	for {
+		select {
+		case c := <-e.queue:
+			e.mu.Lock()
+			scripts := e.scripts
+			e.mu.Unlock()
+			for _, s := range scripts {
+				if err := e.call(s, c.Hook, c.Args); err != nil {
+					logger.Error("ScriptEngine::call", slog.Any("script", s.Name), slog.Any("hook", c.Hook), slog.Any("ERR", err.Error()))
+				}
+			}
+		case <-e.done:
+			return
+		}
+	}
+}
+
+// 受信処理を止めないように、詰まっているときは捨てる
+func (e *ScriptEngine) Dispatch(hook string, args ...any) {
+	e.mu.Lock()
+	empty := len(e.scripts) == 0
+	e.mu.Unlock()
+	if empty {
+		return
+	}
+	select {
+	case e.queue <- scriptCall{Hook: hook, Args: args}:
+	default:
+		logger.Error("ScriptEngine::Dispatch", slog.Any("hook", hook), slog.Any("ERR", "queue full"))
+	}
+}
+
+func (e *ScriptEngine) Close() {
+	close(e.done)
+}
+
+// 時間のかかる処理は別goroutineで実行して、スクリプトの時間制限に含めない
+func (e *ScriptEngine) async(s *script, name string, f func() error) {
+	go func() {
+		if err := f(); err != nil {
+			logger.Error("ScriptHost::"+name, slog.Any("script", s.Name), slog.Any("ERR", err.Error()))
+		}
+	}()
+}
+
+func (e *ScriptEngine) hostApi(s *script) map[string]any {
+	c := e.ctx
+	return map[string]any{
+		"log": func(args ...any) {
+			text := []string{}
+			for _, a := range args {
+				text = append(text, fmt.Sprint(a))
+			}
+			logger.Info("ScriptHost:log", slog.Any("script", s.Name), slog.Any("text", strings.Join(text, " ")))
+		},
+		"stats": func() any {
+			// JSONにしてからスクリプト側のオブジェクトにする(元のデータは触らせない)
+			bin, err := json.Marshal(c.Stats.Snapshot())
+			if err != nil {
+				return nil
+			}
+			var ret any
+			if err := json.Unmarshal(bin, &ret); err != nil {
+				return nil
+			}
+			return ret
+		},
+		"sound": func(path string) {
+			e.async(s, "sound", func() error {
+				soundLock.Lock()
+				defer soundLock.Unlock()
+				return playSoundFile(path)
+			})
+		},
+		"media": func(path string) {
+			e.async(s, "media", func() error {
+				return c.Overlay.TryStartClip(c.Overlay.PublishMedia(path))
+			})
+		},
+		"alert": func(text string) {
+			e.async(s, "alert", func() error {
+				return c.Overlay.TryShowAlert(text)
+			})
+		},
+		"obsScene": func(scene string, seconds int) {
+			e.async(s, "obsScene", func() error {
+				return SwitchObsScene(c.Config, scene, seconds)
+			})
+		},
+		"obsSource": func(scene, source string, seconds int) {
+			e.async(s, "obsSource", func() error {
+				return ShowObsSource(c.Config, scene, source, seconds)
+			})
+		},
+	}
+}
+
+// 各ハンドラの後に呼ばれる
+func (c *BackendContext) RunScripts(subscType string, raw []byte) {
+	if c.Scripts == nil {
+		return
+	}
+	e, err := parseRuleEvent(subscType, raw)
+	if err != nil {
+		logger.Error("RunScripts::parseRuleEvent", slog.Any("ERR", err.Error()))
+		return
+	}
+	c.Scripts.Dispatch(ScriptHookNotification, subscType, e.Event)
+	switch subscType {
+	case "stream.online":
+		c.Scripts.Dispatch(ScriptHookStreamOnline, e.Event)
+	case "stream.offline":
+		c.Scripts.Dispatch(ScriptHookStreamOffline, e.Event)
+	}
+}
+
+func (c *BackendContext) ReloadScripts() error {
+	return c.Scripts.Load(c.Config.ScriptsFullPath())
+}
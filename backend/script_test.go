@@ -0,0 +1,63 @@
+package backend
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+func TestScriptEngine(t *testing.T) {
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.js"), []byte(`
+var received = [];
+function onNotification(type, event) {
+	received.push(type + ":" + event.bits);
+	host.log("cheer", event.bits);
+}
+`), 0644)
+	os.WriteFile(filepath.Join(dir, "b.js"), []byte(`
+function onStreamOnline(event) { while (true) {} }
+`), 0644)
+	os.WriteFile(filepath.Join(dir, "c.js"), []byte(`syntax error(`), 0644)
+
+	ctx := &BackendContext{Stats: NewTwitchStats()}
+	sut := NewScriptEngine(ctx)
+	defer sut.Close()
+	sut.Timeout = 50 * time.Millisecond
+	if err := sut.Load(dir); err == nil {
+		t.Errorf("no error for invalid script")
+	}
+	if len(sut.scripts) != 2 {
+		t.Fatalf("invalid scripts [%v]", len(sut.scripts))
+	}
+	a, b := sut.scripts[0], sut.scripts[1]
+
+	e, _ := parseRuleEvent("channel.cheer", []byte(`{"payload":{"event":{"bits":100}}}`))
+	if err := sut.call(a, ScriptHookNotification, []any{"channel.cheer", e.Event}); err != nil {
+		t.Fatal(err)
+	}
+	if got := a.vm.Get("received").Export(); len(got.([]any)) != 1 || got.([]any)[0] != "channel.cheer:100" {
+		t.Errorf("invalid received [%v]", got)
+	}
+	// 定義されていないフックは何もしない
+	if err := sut.call(a, ScriptHookStreamOnline, []any{e.Event}); err != nil {
+		t.Errorf("error for undefined hook [%v]", err)
+	}
+
+	err := sut.call(b, ScriptHookStreamOnline, []any{e.Event})
+	var interrupted *goja.InterruptedError
+	if !errors.As(err, &interrupted) || interrupted.Value() != ErrScriptTimeout {
+		t.Errorf("infinite loop not interrupted [%v]", err)
+	}
+	// 止めた後も続けて使える
+	if err := sut.call(a, ScriptHookNotification, []any{"channel.cheer", e.Event}); err != nil {
+		t.Errorf("script unusable after interrupt [%v]", err)
+	}
+}
@@ -1,24 +1,52 @@
 package backend
 
+import "time"
+
 const (
 	ToolVersion = "1.11.0"
 
-	KeepAliveSecond        = "30"
-	GlobalScheme           = "wss"
-	GlobalHost             = "eventsub.wss.twitch.tv"
-	LocalTestAddr          = "127.0.0.1:8080"
-	LocalTestScheme        = "ws"
-	ConnectPath            = "/ws"
-	ConfigFilePath         = "config.yaml"
-	AuthInfoFile           = ".auth.yaml"
-	AuthRedirectUri        = "http://localhost"
-	LogFieldName_Type      = "type"
-	LogFieldName_UserName  = "user"
-	LogFieldName_LoginName = "login"
-	LogTextSplit           = "   "
-	StatsLogPath           = "配信履歴.txt"
-	RaidLogPath            = "レイド.txt"
-	NotifySoundDefault     = "C:\\Windows\\Media\\chimes.wav"
+	KeepAliveSecond          = "30"
+	GlobalScheme             = "wss"
+	GlobalHost               = "eventsub.wss.twitch.tv"
+	LocalTestAddr            = "127.0.0.1:8080"
+	LocalTestScheme          = "ws"
+	ConnectPath              = "/ws"
+	ConfigFilePath           = "config.yaml"
+	AuthInfoFile             = ".auth.yaml"
+	AuthRedirectUri          = "http://localhost"
+	LogFieldName_Type        = "type"
+	LogFieldName_UserName    = "user"
+	LogFieldName_LoginName   = "login"
+	LogTextSplit             = "   "
+	StatsLogPath             = "配信履歴.txt"
+	RaidLogPath              = "レイド.txt"
+	KnownChattersPath        = "chatters.txt"
+	StatsCheckpointPath      = "stats_checkpoint.json"
+	StatsCheckpointSecond    = 60
+	StatsRestoreRetry        = 3
+	StatsRestoreRetryWait    = 2 * time.Second
+	StatsRestoreTolerance    = 5 * time.Minute
+	StatsExportDir           = "stats"
+	HistoryDbPath            = "history.db"
+	HistoryKeepDays          = 180
+	HistoryMinKeepDays       = 31
+	ChatReportTopN           = 5
+	LeaderboardTopN          = 5
+	LeaderboardMaxN          = 50
+	OverlayHeartbeatInterval = 15 * time.Second
+	OverlayBacklogSize       = 64
+	OverlayClientBufferSize  = 16
+	ClipEndedMargin          = 5 * time.Second
+	ChatBadgeRefreshInterval = time.Hour
+	ScriptsDir               = "scripts"
+	OverlayDefaultDir        = "overlay"
+	OverlayDefaultBind       = "127.0.0.1"
+	OverlayTokenCookie       = "sttool_overlay_token"
+	ClipCacheDefaultDir      = "clipcache"
+	ClipDownloadTimeout      = 3 * time.Minute
+	ScriptTimeout            = 2 * time.Second
+	ScriptQueueSize          = 64
+	NotifySoundDefault       = "C:\\Windows\\Media\\chimes.wav"
 
 	RequestErrorBy401 = "RequestErrorBy401"
 )
@@ -28,6 +56,7 @@ var (
 		"bits:read",
 		"channel:read:subscriptions",
 		"channel:read:redemptions",
+		"channel:manage:redemptions",
 		"channel:manage:raids",
 		"moderator:read:followers",
 		"user:read:chat",
@@ -1,8 +1,11 @@
 package backend
 
 import (
-	"fmt"
 	"io"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
 	"time"
 )
 
@@ -15,7 +18,8 @@ type PeriodStats struct {
 }
 
 type FollowStats struct {
-	Users []UserName
+	Users   []UserName
+	FirstAt map[UserName]time.Time
 }
 
 type ViewerStats struct {
@@ -29,9 +33,28 @@ type ChatEntry struct {
 	Text string
 }
 
+type EmoteRecord struct {
+	Name  string
+	Times int
+}
+
 type ChatStats struct {
-	Total   int
-	History []ChatEntry
+	Total     int
+	History   []ChatEntry
+	Chatters  map[UserName]int
+	FirstTime []UserName
+	Emotes    map[string]EmoteRecord
+	FirstAt   map[UserName]time.Time
+}
+
+type UserCount struct {
+	User  UserName
+	Times int
+}
+
+type ChatPeak struct {
+	Time  time.Time
+	Total int
 }
 
 type BitsRecord struct {
@@ -42,19 +65,61 @@ type BitsRecord struct {
 type CheerStats struct {
 	TotalBits int
 	History   map[UserName]BitsRecord
+	FirstAt   map[UserName]time.Time
 }
 
 type SubGiftStats struct {
 	TotalGifts int
 	History    map[UserName]int
+	FirstAt    map[UserName]time.Time
+	Tiers      map[string]int // ティアごとの個数
 }
 
 type SubGiftReceived struct {
 	History map[UserName]int
+	FirstAt map[UserName]time.Time
+	Tiers   map[string]int
+}
+
+// サブスクのティア
+// EventSubのtierは1000/2000/3000のみなので、Primeは channel.chat.notification の is_prime で判別する
+const (
+	SubTier1     = "1000"
+	SubTier2     = "2000"
+	SubTier3     = "3000"
+	SubTierPrime = "Prime"
+)
+
+var SubTiers = []string{SubTier1, SubTier2, SubTier3, SubTierPrime}
+
+// サブスクポイント(Tier3は6pt)
+func SubPoints(tier string) int {
+	switch tier {
+	case SubTier2:
+		return 2
+	case SubTier3:
+		return 6
+	case SubTier1, SubTierPrime:
+		return 1
+	}
+	return 0
 }
 
 type SubScriptionEntry struct {
-	Tier string
+	Tier             string
+	First            time.Time
+	ReSub            bool
+	CumulativeMonths int
+	StreakMonths     int
+	DurationMonths   int
+}
+
+type SubTierBreakdown struct {
+	Tier   string
+	Subs   int // 新規
+	ReSubs int // 継続
+	Gifts  int // ギフト(贈った側の個数)
+	Points int
 }
 
 type SubScriptionStats struct {
@@ -63,12 +128,51 @@ type SubScriptionStats struct {
 
 type ChannelPointStats struct {
 	TotalTimes int
+	TotalCost  int
 	Record     map[UserName]int
+	FirstAt    map[UserName]time.Time
+	Rewards    map[ChannelPointTitle]RewardRecord
+}
+
+// 入力が必要な報酬でユーザが入力した内容
+type RewardInput struct {
+	Time time.Time
+	User UserName
+	Text string
+}
+
+// 報酬ごとの集計
+type RewardRecord struct {
+	Times   int
+	Cost    int // 消費されたポイントの合計
+	First   time.Time
+	Users   map[UserName]int
+	FirstAt map[UserName]time.Time // この報酬をユーザが最初に引き換えた時刻
+	Inputs  []RewardInput
+}
+
+func (r RewardRecord) clone() RewardRecord {
+	r.Users = maps.Clone(r.Users)
+	r.FirstAt = maps.Clone(r.FirstAt)
+	r.Inputs = slices.Clone(r.Inputs)
+	return r
+}
+
+func cloneRewards(m map[ChannelPointTitle]RewardRecord) map[ChannelPointTitle]RewardRecord {
+	if m == nil {
+		return nil
+	}
+	ret := map[ChannelPointTitle]RewardRecord{}
+	for k, v := range m {
+		ret[k] = v.clone()
+	}
+	return ret
 }
 
 type RaidEntry struct {
 	From    UserName
 	Viewers int
+	Time    time.Time
 }
 
 type RaidStats struct {
@@ -78,11 +182,13 @@ type RaidStats struct {
 type GigantifiedEmoteHistory struct {
 	Times   int
 	History map[UserName]int
+	FirstAt map[UserName]time.Time
 }
 
 type MessegeEffectHistory struct {
 	Times   int
 	History map[UserName]int
+	FirstAt map[UserName]time.Time
 }
 
 type PowerUpStats struct {
@@ -90,7 +196,11 @@ type PowerUpStats struct {
 	MessegeEffectHistory    MessegeEffectHistory
 }
 
+// EventSubの受信goroutineから記録され、オーバーレイやフロントエンドなど
+// 別goroutineから参照されるため、フィールドへのアクセスはmuで保護する
+// 外から参照する場合はLoad*系やSnapshot()を使うこと(コピーを返す)
 type TwitchStats struct {
+	mu                sync.RWMutex
 	InStreaming       bool
 	LastPeriod        PeriodStats
 	FollowStats       FollowStats
@@ -103,6 +213,7 @@ type TwitchStats struct {
 	ChannelPoinsts    ChannelPointStats
 	RaidStats         RaidStats
 	PowerUpStats      PowerUpStats
+	onChanged         func()
 }
 
 func NewTwitchStats() *TwitchStats {
@@ -111,15 +222,44 @@ func NewTwitchStats() *TwitchStats {
 	return ret
 }
 
+// フォロー、サブスク、cheerなどオーバーレイに出す内容が変わったときに呼ぶ
+// ロックを取ったまま呼ぶので f の中で待ったり TwitchStats を参照したりしないこと
+func (t *TwitchStats) SetOnChanged(f func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onChanged = f
+}
+
+func (t *TwitchStats) changed() {
+	if t.onChanged != nil {
+		t.onChanged()
+	}
+}
+
 func (t *TwitchStats) Clear() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.clear()
+}
+
+func (t *TwitchStats) clear() {
 	t.InStreaming = false
-	t.FollowStats.Users = []UserName{}
+	t.FollowStats = FollowStats{
+		Users:   []UserName{},
+		FirstAt: map[UserName]time.Time{},
+	}
 	t.ChatStats = ChatStats{
-		Total: 0,
+		Total:     0,
+		History:   []ChatEntry{},
+		Chatters:  map[UserName]int{},
+		FirstTime: []UserName{},
+		Emotes:    map[string]EmoteRecord{},
+		FirstAt:   map[UserName]time.Time{},
 	}
 	t.CheerStats = CheerStats{
 		TotalBits: 0,
 		History:   map[UserName]BitsRecord{},
+		FirstAt:   map[UserName]time.Time{},
 	}
 	t.SubScriptionStats = SubScriptionStats{
 		Entry: map[UserName]SubScriptionEntry{},
@@ -127,14 +267,21 @@ func (t *TwitchStats) Clear() {
 	t.SubGiftStats = SubGiftStats{
 		TotalGifts: 0,
 		History:    map[UserName]int{},
+		FirstAt:    map[UserName]time.Time{},
+		Tiers:      map[string]int{},
 	}
 	t.SubGiftReceived = SubGiftReceived{
 		History: map[UserName]int{},
+		FirstAt: map[UserName]time.Time{},
+		Tiers:   map[string]int{},
 	}
 	t.ViewersHistory = []ViewerStats{}
 	t.ChannelPoinsts = ChannelPointStats{
 		TotalTimes: 0,
+		TotalCost:  0,
 		Record:     map[UserName]int{},
+		FirstAt:    map[UserName]time.Time{},
+		Rewards:    map[ChannelPointTitle]RewardRecord{},
 	}
 	t.RaidStats = RaidStats{
 		History: []RaidEntry{},
@@ -143,77 +290,42 @@ func (t *TwitchStats) Clear() {
 		GigantifiedEmoteHistory: GigantifiedEmoteHistory{
 			Times:   0,
 			History: map[UserName]int{},
+			FirstAt: map[UserName]time.Time{},
 		},
 		MessegeEffectHistory: MessegeEffectHistory{
 			Times:   0,
 			History: map[UserName]int{},
+			FirstAt: map[UserName]time.Time{},
 		},
 	}
 }
 
+// チェックポイントなどから読み込んだ内容で置き換える
+func (t *TwitchStats) Restore(src *TwitchStats) {
+	s := src.Snapshot()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.InStreaming = s.InStreaming
+	t.LastPeriod = s.LastPeriod
+	t.FollowStats = s.FollowStats
+	t.ChatStats = s.ChatStats
+	t.CheerStats = s.CheerStats
+	t.SubScriptionStats = s.SubScriptionStats
+	t.SubGiftStats = s.SubGiftStats
+	t.SubGiftReceived = s.SubGiftReceived
+	t.ViewersHistory = s.ViewersHistory
+	t.ChannelPoinsts = s.ChannelPoinsts
+	t.RaidStats = s.RaidStats
+	t.PowerUpStats = s.PowerUpStats
+	t.changed()
+}
+
 func (t *TwitchStats) String(topIndent, namePrefix string) string {
-	raidTimes, _ := t.LoadRaidResult()
-	started := t.LastPeriod.Started.Format("2006/01/02 15:04:05")
-	finished := t.LastPeriod.Finished.Format("2006/01/02 15:04:05")
-	followResult := fmt.Sprintf("%v新規フォロー: %v人\n", topIndent, len(t.FollowStats.Users))
-	for _, u := range t.FollowStats.Users {
-		followResult += fmt.Sprintf("%v  %v%vさん\n", topIndent, namePrefix, u)
-	}
-	chanepoResult := fmt.Sprintf("%vチャネポ総回数: %v\n", topIndent, t.LoadChannelPointTotal())
-	for name, times := range t.LoadChannelPointHistory() {
-		chanepoResult += fmt.Sprintf("%v  %v%vさん: %v回\n", topIndent, namePrefix, name, times)
-	}
-	subscResult := fmt.Sprintf("%v新規サブスク: %v人\n", topIndent, len(t.LoadSubScribed()))
-	for name := range t.LoadSubscriptonHistory() {
-		subscResult += fmt.Sprintf("%v  %v%vさん\n", topIndent, namePrefix, name)
-	}
-	subGifResult := fmt.Sprintf("%v総サブギフ個数: %v個\n", topIndent, t.LoadSubGiftTotal())
-	for name, times := range t.LoadSubGiftHistory() {
-		subGifResult += fmt.Sprintf("%v  %v%vさん(%v個)\n", topIndent, namePrefix, name, times)
-	}
-	subGifRecvResult := fmt.Sprintf("%v  >> サブギフ受け取った: %v人\n", topIndent, len(t.LoadSubGifted()))
-	for name := range t.LoadSubGifted() {
-		subGifRecvResult += fmt.Sprintf("%v    %v%vさん\n", topIndent, namePrefix, name)
-	}
-	cheerResult := fmt.Sprintf("%vビッツ: %v\n", topIndent, t.LoadCheerTotal())
-	for name, bitsRecord := range t.LoadCheerHistory() {
-		cheerResult += fmt.Sprintf("%v  %v%vさん(%v ビッツ)\n", topIndent, namePrefix, name, bitsRecord.Bits)
-	}
-	raidResult := fmt.Sprintf("%vレイド: %v回\n", topIndent, raidTimes)
-	for _, e := range t.LoadRaidHistory() {
-		raidResult += fmt.Sprintf("%v  %v%vさん\n", topIndent, namePrefix, e.From)
-	}
-	gigantifiedEmoteResult := fmt.Sprintf("%v巨大化スタンプ: %v回\n", topIndent, t.LoadGigantifiedEmoteTimes())
-	for k, v := range t.LoadGigantifiedEmoteHistory() {
-		gigantifiedEmoteResult += fmt.Sprintf("%v  %v%vさん : %v回\n", topIndent, namePrefix, k, v)
-	}
-	messageEffectResult := fmt.Sprintf("%vメッセージエフェクト: %v回\n", topIndent, t.LoadMessageEffectTimes())
-	for k, v := range t.LoadMessageEffectHistory() {
-		messageEffectResult += fmt.Sprintf("%v  %v%vさん : %v回\n", topIndent, namePrefix, k, v)
-	}
-	return fmt.Sprintf(
-		"------------------------------------------------------------\n"+
-			"%v配信時間: %v ~ %v\n"+
-			"%v"+
-			"%v"+
-			"%v"+
-			"%v"+
-			"%v"+
-			"%v"+
-			"%v"+
-			"%v"+
-			"%v",
-		topIndent, started, finished,
-		followResult,
-		chanepoResult,
-		subscResult,
-		subGifResult,
-		subGifRecvResult,
-		cheerResult,
-		raidResult,
-		gigantifiedEmoteResult,
-		messageEffectResult,
-	)
+	ret, err := t.Render(DefaultSummaryTemplate, topIndent, namePrefix)
+	if err != nil {
+		return err.Error()
+	}
+	return ret
 }
 
 func (t *TwitchStats) Dump(w io.Writer, topIndent, namePrefix string) {
@@ -221,45 +333,119 @@ func (t *TwitchStats) Dump(w io.Writer, topIndent, namePrefix string) {
 }
 
 func (t *TwitchStats) StreamStarted() {
-	t.Clear()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.clear()
 	t.InStreaming = true
 	t.LastPeriod.Started = time.Now()
+	t.changed()
 }
 
 func (t *TwitchStats) StreamFinished() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.LastPeriod.Finished = time.Now()
 	t.InStreaming = false
 }
 
+// 並び替え用に最初に記録した時刻だけを残す
+func markFirstAt(m map[UserName]time.Time, user UserName) {
+	if _, exists := m[user]; !exists {
+		m[user] = time.Now()
+	}
+}
+
 func (t *TwitchStats) Follow(user UserName) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	if t.InStreaming == false {
 		return
 	}
 	t.FollowStats.Users = append(t.FollowStats.Users, user)
+	markFirstAt(t.FollowStats.FirstAt, user)
+	t.changed()
 }
 
 func (t *TwitchStats) Chat(user UserName, text string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	if t.InStreaming == false {
 		return
 	}
 	t.ChatStats.Total += 1
 	t.ChatStats.History = append(t.ChatStats.History, ChatEntry{Time: time.Now(), User: user, Text: text})
+	t.ChatStats.Chatters[user] += 1
+	markFirstAt(t.ChatStats.FirstAt, user)
 }
 
-func (t *TwitchStats) ChannelPoint(user UserName, title ChannelPointTitle) {
+// 過去の配信を含めて初めてチャットした人
+func (t *TwitchStats) FirstChat(user UserName) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.InStreaming == false {
+		return
+	}
+	t.ChatStats.FirstTime = append(t.ChatStats.FirstTime, user)
+}
+
+func (t *TwitchStats) Emote(id, name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.InStreaming == false {
+		return
+	}
+	if v, exists := t.ChatStats.Emotes[id]; exists {
+		v.Times += 1
+		t.ChatStats.Emotes[id] = v
+	} else {
+		t.ChatStats.Emotes[id] = EmoteRecord{Name: name, Times: 1}
+	}
+}
+
+// inputは入力が必要な報酬のときだけ入っている
+func (t *TwitchStats) ChannelPoint(user UserName, title ChannelPointTitle, cost int, input string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	if t.InStreaming == false {
 		return
 	}
 	t.ChannelPoinsts.TotalTimes += 1
+	t.ChannelPoinsts.TotalCost += cost
+	markFirstAt(t.ChannelPoinsts.FirstAt, user)
 	if _, exists := t.ChannelPoinsts.Record[user]; exists {
 		t.ChannelPoinsts.Record[user] += 1
 	} else {
 		t.ChannelPoinsts.Record[user] = 1
 	}
+	now := time.Now()
+	v, exists := t.ChannelPoinsts.Rewards[title]
+	if !exists {
+		v = RewardRecord{First: now, Inputs: []RewardInput{}}
+	}
+	if v.Users == nil {
+		v.Users = map[UserName]int{}
+	}
+	if v.FirstAt == nil {
+		v.FirstAt = map[UserName]time.Time{}
+	}
+	v.Times += 1
+	v.Cost += cost
+	v.Users[user] += 1
+	markFirstAt(v.FirstAt, user)
+	if input != "" {
+		v.Inputs = append(v.Inputs, RewardInput{Time: now, User: user, Text: input})
+	}
+	t.ChannelPoinsts.Rewards[title] = v
 }
 
 func (t *TwitchStats) Cheer(user UserName, n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.InStreaming == false {
+		return
+	}
 	t.CheerStats.TotalBits += n
+	markFirstAt(t.CheerStats.FirstAt, user)
 	if v, exists := t.CheerStats.History[user]; exists {
 		v.Bits += n
 		v.Times += 1
@@ -267,19 +453,35 @@ func (t *TwitchStats) Cheer(user UserName, n int) {
 	} else {
 		t.CheerStats.History[user] = BitsRecord{Bits: n, Times: 1}
 	}
+	t.changed()
 }
 
-func (t *TwitchStats) SubGift(user UserName, n int) {
+func (t *TwitchStats) SubGift(user UserName, n int, tier string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.InStreaming == false {
+		return
+	}
 	t.SubGiftStats.TotalGifts += n
+	t.SubGiftStats.Tiers[tier] += n
+	markFirstAt(t.SubGiftStats.FirstAt, user)
 	if v, exists := t.SubGiftStats.History[user]; exists {
 		v += n
 		t.SubGiftStats.History[user] = v
 	} else {
 		t.SubGiftStats.History[user] = n
 	}
+	t.changed()
 }
 
 func (t *TwitchStats) SubGifted(user UserName, tier string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.InStreaming == false {
+		return
+	}
+	markFirstAt(t.SubGiftReceived.FirstAt, user)
+	t.SubGiftReceived.Tiers[tier] += 1
 	if v, exists := t.SubGiftReceived.History[user]; exists {
 		v += 1
 		t.SubGiftReceived.History[user] = v
@@ -289,23 +491,64 @@ func (t *TwitchStats) SubGifted(user UserName, tier string) {
 }
 
 func (t *TwitchStats) SubScribe(user UserName, tier string) {
-	if v, exists := t.SubScriptionStats.Entry[user]; exists {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.InStreaming == false {
+		return
+	}
+	t.subScribe(user, tier)
+	t.changed()
+}
+
+// channel.subscription.message で届く継続サブスク
+func (t *TwitchStats) ReSubScribe(user UserName, tier string, cumulative, streak, duration int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.InStreaming == false {
+		return
+	}
+	v := t.subScribe(user, tier)
+	v.ReSub = true
+	v.CumulativeMonths = cumulative
+	v.StreakMonths = streak
+	v.DurationMonths = duration
+	t.SubScriptionStats.Entry[user] = v
+	t.changed()
+}
+
+func (t *TwitchStats) subScribe(user UserName, tier string) SubScriptionEntry {
+	v, exists := t.SubScriptionStats.Entry[user]
+	if !exists {
+		v.First = time.Now()
+	}
+	// Primeと判明している場合は後から届いたtier(1000)で上書きしない
+	if v.Tier != SubTierPrime || tier != SubTier1 {
 		v.Tier = tier
-		t.SubScriptionStats.Entry[user] = v
-	} else {
-		t.SubScriptionStats.Entry[user] = SubScriptionEntry{Tier: tier}
 	}
+	t.SubScriptionStats.Entry[user] = v
+	return v
 }
 
 func (t *TwitchStats) Raid(from UserName, viewers int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.InStreaming == false {
+		return
+	}
 	t.RaidStats.History = append(
 		t.RaidStats.History,
-		RaidEntry{From: from, Viewers: viewers},
+		RaidEntry{From: from, Viewers: viewers, Time: time.Now()},
 	)
 }
 
 func (t *TwitchStats) GigantifiedEmote(from UserName) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.InStreaming == false {
+		return
+	}
 	t.PowerUpStats.GigantifiedEmoteHistory.Times += 1
+	markFirstAt(t.PowerUpStats.GigantifiedEmoteHistory.FirstAt, from)
 	if _, exists := t.PowerUpStats.GigantifiedEmoteHistory.History[from]; exists {
 		t.PowerUpStats.GigantifiedEmoteHistory.History[from] += 1
 	} else {
@@ -314,7 +557,13 @@ func (t *TwitchStats) GigantifiedEmote(from UserName) {
 }
 
 func (t *TwitchStats) MessageEffect(from UserName) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.InStreaming == false {
+		return
+	}
 	t.PowerUpStats.MessegeEffectHistory.Times += 1
+	markFirstAt(t.PowerUpStats.MessegeEffectHistory.FirstAt, from)
 	if _, exists := t.PowerUpStats.MessegeEffectHistory.History[from]; exists {
 		t.PowerUpStats.MessegeEffectHistory.History[from] += 1
 	} else {
@@ -324,51 +573,306 @@ func (t *TwitchStats) MessageEffect(from UserName) {
 
 // --- loader
 
+func (t *TwitchStats) IsStreaming() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.InStreaming
+}
+
+// 記録内容をまるごとコピーして返す
+func (t *TwitchStats) Snapshot() *TwitchStats {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return &TwitchStats{
+		InStreaming: t.InStreaming,
+		LastPeriod:  t.LastPeriod,
+		FollowStats: FollowStats{
+			Users:   slices.Clone(t.FollowStats.Users),
+			FirstAt: maps.Clone(t.FollowStats.FirstAt),
+		},
+		ChatStats: ChatStats{
+			Total:     t.ChatStats.Total,
+			History:   slices.Clone(t.ChatStats.History),
+			Chatters:  maps.Clone(t.ChatStats.Chatters),
+			FirstTime: slices.Clone(t.ChatStats.FirstTime),
+			Emotes:    maps.Clone(t.ChatStats.Emotes),
+			FirstAt:   maps.Clone(t.ChatStats.FirstAt),
+		},
+		CheerStats: CheerStats{
+			TotalBits: t.CheerStats.TotalBits,
+			History:   maps.Clone(t.CheerStats.History),
+			FirstAt:   maps.Clone(t.CheerStats.FirstAt),
+		},
+		SubScriptionStats: SubScriptionStats{
+			Entry: maps.Clone(t.SubScriptionStats.Entry),
+		},
+		SubGiftStats: SubGiftStats{
+			TotalGifts: t.SubGiftStats.TotalGifts,
+			History:    maps.Clone(t.SubGiftStats.History),
+			FirstAt:    maps.Clone(t.SubGiftStats.FirstAt),
+			Tiers:      maps.Clone(t.SubGiftStats.Tiers),
+		},
+		SubGiftReceived: SubGiftReceived{
+			History: maps.Clone(t.SubGiftReceived.History),
+			FirstAt: maps.Clone(t.SubGiftReceived.FirstAt),
+			Tiers:   maps.Clone(t.SubGiftReceived.Tiers),
+		},
+		ViewersHistory: slices.Clone(t.ViewersHistory),
+		ChannelPoinsts: ChannelPointStats{
+			TotalTimes: t.ChannelPoinsts.TotalTimes,
+			TotalCost:  t.ChannelPoinsts.TotalCost,
+			Record:     maps.Clone(t.ChannelPoinsts.Record),
+			FirstAt:    maps.Clone(t.ChannelPoinsts.FirstAt),
+			Rewards:    cloneRewards(t.ChannelPoinsts.Rewards),
+		},
+		RaidStats: RaidStats{
+			History: slices.Clone(t.RaidStats.History),
+		},
+		PowerUpStats: PowerUpStats{
+			GigantifiedEmoteHistory: GigantifiedEmoteHistory{
+				Times:   t.PowerUpStats.GigantifiedEmoteHistory.Times,
+				History: maps.Clone(t.PowerUpStats.GigantifiedEmoteHistory.History),
+				FirstAt: maps.Clone(t.PowerUpStats.GigantifiedEmoteHistory.FirstAt),
+			},
+			MessegeEffectHistory: MessegeEffectHistory{
+				Times:   t.PowerUpStats.MessegeEffectHistory.Times,
+				History: maps.Clone(t.PowerUpStats.MessegeEffectHistory.History),
+				FirstAt: maps.Clone(t.PowerUpStats.MessegeEffectHistory.FirstAt),
+			},
+		},
+	}
+}
+
 func (t *TwitchStats) LoadPeriod() time.Duration {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	return t.LastPeriod.Finished.Sub(t.LastPeriod.Started)
 }
 
+func (t *TwitchStats) LoadPeriodStarted() time.Time {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.LastPeriod.Started
+}
+
+func (t *TwitchStats) LoadPeriodFinished() time.Time {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.LastPeriod.Finished
+}
+
 func (t *TwitchStats) LoadNChats() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	return t.ChatStats.Total
 }
 
 func (t *TwitchStats) LoadChatHistory() []ChatEntry {
-	return t.ChatStats.History
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return slices.Clone(t.ChatStats.History)
+}
+
+func (t *TwitchStats) LoadNChatters() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.ChatStats.Chatters)
+}
+
+func (t *TwitchStats) LoadChatters() map[UserName]int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return maps.Clone(t.ChatStats.Chatters)
+}
+
+// チャット数の多い順に最大n人
+func (t *TwitchStats) LoadTopChatters(n int) []UserCount {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	ret := sortByCount(t.ChatStats.Chatters)
+	if len(ret) > n {
+		ret = ret[:n]
+	}
+	return ret
+}
+
+func (t *TwitchStats) LoadFirstTimeChatters() []UserName {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return slices.Clone(t.ChatStats.FirstTime)
+}
+
+// 1分ごとのチャット数が多い順に最大n件
+func (t *TwitchStats) LoadChatPeaks(n int) []ChatPeak {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	perMinute := map[time.Time]int{}
+	for _, e := range t.ChatStats.History {
+		perMinute[e.Time.Truncate(time.Minute)] += 1
+	}
+	ret := []ChatPeak{}
+	for k, v := range perMinute {
+		ret = append(ret, ChatPeak{Time: k, Total: v})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Total != ret[j].Total {
+			return ret[i].Total > ret[j].Total
+		}
+		return ret[i].Time.Before(ret[j].Time)
+	})
+	if len(ret) > n {
+		ret = ret[:n]
+	}
+	return ret
+}
+
+func (t *TwitchStats) LoadEmoteHistory() map[string]EmoteRecord {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return maps.Clone(t.ChatStats.Emotes)
+}
+
+// 使用回数の多い順に最大n個
+func (t *TwitchStats) LoadTopEmotes(n int) []EmoteRecord {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	ret := []EmoteRecord{}
+	for _, v := range t.ChatStats.Emotes {
+		ret = append(ret, v)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Times != ret[j].Times {
+			return ret[i].Times > ret[j].Times
+		}
+		return ret[i].Name < ret[j].Name
+	})
+	if len(ret) > n {
+		ret = ret[:n]
+	}
+	return ret
 }
 
 func (t *TwitchStats) LoadCheerTotal() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	return t.CheerStats.TotalBits
 }
 
 func (t *TwitchStats) LoadCheerHistory() map[UserName]BitsRecord {
-	return t.CheerStats.History
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return maps.Clone(t.CheerStats.History)
 }
 
 func (t *TwitchStats) LoadSubGiftTotal() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	return t.SubGiftStats.TotalGifts
 }
 
 func (t *TwitchStats) LoadSubGiftHistory() map[UserName]int {
-	return t.SubGiftStats.History
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return maps.Clone(t.SubGiftStats.History)
 }
 
 func (t *TwitchStats) LoadSubGifted() map[UserName]int {
-	return t.SubGiftReceived.History
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return maps.Clone(t.SubGiftReceived.History)
 }
 
 func (t *TwitchStats) LoadSubScribed() map[UserName]SubScriptionEntry {
-	return t.SubScriptionStats.Entry
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return maps.Clone(t.SubScriptionStats.Entry)
+}
+
+func (t *TwitchStats) LoadSubGiftTiers() map[string]int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return maps.Clone(t.SubGiftStats.Tiers)
+}
+
+// ティアごとの新規/継続/ギフト数とポイント(SubTiersの順)
+// 想定外のtierは末尾にまとめる
+func (t *TwitchStats) LoadSubTierBreakdown() []SubTierBreakdown {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	m := map[string]*SubTierBreakdown{}
+	get := func(tier string) *SubTierBreakdown {
+		if _, exists := m[tier]; !exists {
+			m[tier] = &SubTierBreakdown{Tier: tier}
+		}
+		return m[tier]
+	}
+	for _, e := range t.SubScriptionStats.Entry {
+		b := get(e.Tier)
+		if e.ReSub {
+			b.ReSubs += 1
+		} else {
+			b.Subs += 1
+		}
+		b.Points += SubPoints(e.Tier)
+	}
+	for tier, n := range t.SubGiftStats.Tiers {
+		b := get(tier)
+		b.Gifts += n
+		b.Points += SubPoints(tier) * n
+	}
+	ret := []SubTierBreakdown{}
+	for _, tier := range SubTiers {
+		if b, exists := m[tier]; exists {
+			ret = append(ret, *b)
+			delete(m, tier)
+		}
+	}
+	others := []string{}
+	for tier := range m {
+		others = append(others, tier)
+	}
+	sort.Strings(others)
+	for _, tier := range others {
+		ret = append(ret, *m[tier])
+	}
+	return ret
+}
+
+func (t *TwitchStats) LoadSubPoints() int {
+	ret := 0
+	for _, b := range t.LoadSubTierBreakdown() {
+		ret += b.Points
+	}
+	return ret
 }
 
 func (t *TwitchStats) LoadChannelPointTotal() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	return t.ChannelPoinsts.TotalTimes
 }
 
+func (t *TwitchStats) LoadChannelPointCost() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.ChannelPoinsts.TotalCost
+}
+
+func (t *TwitchStats) LoadChannelPointRewards() map[ChannelPointTitle]RewardRecord {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return cloneRewards(t.ChannelPoinsts.Rewards)
+}
+
 func (t *TwitchStats) LoadChannelPointHistory() map[UserName]int {
-	return t.ChannelPoinsts.Record
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return maps.Clone(t.ChannelPoinsts.Record)
 }
 
 func (t *TwitchStats) LoadChannelPointTimes(user UserName) int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	if _, exists := t.ChannelPoinsts.Record[user]; exists {
 		return t.ChannelPoinsts.Record[user]
 	} else {
@@ -377,10 +881,14 @@ func (t *TwitchStats) LoadChannelPointTimes(user UserName) int {
 }
 
 func (t *TwitchStats) LoadSubscriptonHistory() map[UserName]SubScriptionEntry {
-	return t.SubScriptionStats.Entry
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return maps.Clone(t.SubScriptionStats.Entry)
 }
 
 func (t *TwitchStats) LoadRaidResult() (int, int) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	times := len(t.RaidStats.History)
 	total := 0
 	for _, e := range t.RaidStats.History {
@@ -390,21 +898,31 @@ func (t *TwitchStats) LoadRaidResult() (int, int) {
 }
 
 func (t *TwitchStats) LoadRaidHistory() []RaidEntry {
-	return t.RaidStats.History
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return slices.Clone(t.RaidStats.History)
 }
 
 func (t *TwitchStats) LoadGigantifiedEmoteTimes() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	return t.PowerUpStats.GigantifiedEmoteHistory.Times
 }
 
 func (t *TwitchStats) LoadGigantifiedEmoteHistory() map[UserName]int {
-	return t.PowerUpStats.GigantifiedEmoteHistory.History
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return maps.Clone(t.PowerUpStats.GigantifiedEmoteHistory.History)
 }
 
 func (t *TwitchStats) LoadMessageEffectTimes() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	return t.PowerUpStats.MessegeEffectHistory.Times
 }
 
 func (t *TwitchStats) LoadMessageEffectHistory() map[UserName]int {
-	return t.PowerUpStats.MessegeEffectHistory.History
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return maps.Clone(t.PowerUpStats.MessegeEffectHistory.History)
 }
@@ -1,6 +1,12 @@
 package backend
 
 import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
 	"testing"
 	"time"
 )
@@ -55,7 +61,7 @@ func TestTwitchStats_ChannelPoint(t *testing.T) {
 	title := ChannelPointTitle("にほんごのタイトル")
 	title2 := ChannelPointTitle("べつのタイトル")
 
-	sut.ChannelPoint(user1, title)
+	sut.ChannelPoint(user1, title, 100, "")
 	if sut.LoadChannelPointTotal() != 1 {
 		t.Errorf("invalid channel points total [n:%v]", sut.LoadChannelPointTotal())
 	}
@@ -66,7 +72,7 @@ func TestTwitchStats_ChannelPoint(t *testing.T) {
 		t.Errorf("invalid channel points times(2) [n:%v]", sut.LoadChannelPointTimes(user2))
 	}
 
-	sut.ChannelPoint(user2, title2)
+	sut.ChannelPoint(user2, title2, 50, "input")
 	if sut.LoadChannelPointTotal() != 2 {
 		t.Errorf("invalid channel points total [n:%v]", sut.LoadChannelPointTotal())
 	}
@@ -77,7 +83,7 @@ func TestTwitchStats_ChannelPoint(t *testing.T) {
 		t.Errorf("invalid channel points times(2) [n:%v]", sut.LoadChannelPointTimes(user2))
 	}
 
-	sut.ChannelPoint(user2, title2)
+	sut.ChannelPoint(user2, title2, 50, "input")
 	if sut.LoadChannelPointTotal() != 3 {
 		t.Errorf("invalid channel points total [n:%v]", sut.LoadChannelPointTotal())
 	}
@@ -153,3 +159,440 @@ func TestTwitchStats_ChannelCheer(t *testing.T) {
 
 	sut.StreamFinished()
 }
+
+func TestTwitchStats_ChatAnalytics(t *testing.T) {
+	sut := NewTwitchStats()
+	sut.Chat("bob", "before stream")
+	sut.FirstChat("bob")
+	sut.Emote("1", "Kappa")
+	if sut.LoadNChats() != 0 || len(sut.LoadFirstTimeChatters()) != 0 || len(sut.LoadEmoteHistory()) != 0 {
+		t.Errorf("recorded out of stream [chat:%v first:%v emote:%v]", sut.LoadNChats(), len(sut.LoadFirstTimeChatters()), len(sut.LoadEmoteHistory()))
+	}
+
+	sut.StreamStarted()
+	sut.Chat("bob", "hi")
+	sut.Chat("tom", "hello")
+	sut.Chat("bob", "Kappa Kappa")
+	sut.FirstChat("tom")
+	sut.Emote("1", "Kappa")
+	sut.Emote("1", "Kappa")
+	sut.Emote("2", "LUL")
+
+	if sut.LoadNChatters() != 2 {
+		t.Errorf("invalid unique chatters [n:%v]", sut.LoadNChatters())
+	}
+	top := sut.LoadTopChatters(1)
+	if len(top) != 1 || top[0].User != "bob" || top[0].Times != 2 {
+		t.Errorf("invalid top chatters [%v]", top)
+	}
+	first := sut.LoadFirstTimeChatters()
+	if len(first) != 1 || first[0] != "tom" {
+		t.Errorf("invalid first time chatters [%v]", first)
+	}
+	emotes := sut.LoadTopEmotes(5)
+	if len(emotes) != 2 || emotes[0].Name != "Kappa" || emotes[0].Times != 2 {
+		t.Errorf("invalid emotes [%v]", emotes)
+	}
+
+	now := time.Now().Truncate(time.Minute)
+	sut.ChatStats.History = []ChatEntry{
+		{Time: now, User: "bob"},
+		{Time: now.Add(time.Minute), User: "bob"},
+		{Time: now.Add(time.Minute + time.Second), User: "tom"},
+	}
+	peaks := sut.LoadChatPeaks(1)
+	if len(peaks) != 1 || !peaks[0].Time.Equal(now.Add(time.Minute)) || peaks[0].Total != 2 {
+		t.Errorf("invalid chat peaks [%v]", peaks)
+	}
+	sut.StreamFinished()
+}
+
+func TestTwitchStats_NotInStreaming(t *testing.T) {
+	sut := NewTwitchStats()
+	sut.Follow("user1")
+	sut.ChannelPoint("user1", "title", 100, "")
+	sut.Cheer("user1", 100)
+	sut.SubGift("user1", 5, SubTier1)
+	sut.SubGifted("user2", "1000")
+	sut.SubScribe("user1", "1000")
+	sut.Raid("user1", 10)
+	sut.GigantifiedEmote("user1")
+	sut.MessageEffect("user1")
+
+	s := sut.Snapshot()
+	if len(s.FollowStats.Users) != 0 {
+		t.Errorf("follow recorded out of stream [n:%v]", len(s.FollowStats.Users))
+	}
+	if s.LoadChannelPointTotal() != 0 {
+		t.Errorf("channel point recorded out of stream [n:%v]", s.LoadChannelPointTotal())
+	}
+	if s.LoadCheerTotal() != 0 {
+		t.Errorf("cheer recorded out of stream [n:%v]", s.LoadCheerTotal())
+	}
+	if s.LoadSubGiftTotal() != 0 || len(s.LoadSubGifted()) != 0 {
+		t.Errorf("sub gift recorded out of stream [n:%v, recv:%v]", s.LoadSubGiftTotal(), len(s.LoadSubGifted()))
+	}
+	if len(s.LoadSubScribed()) != 0 {
+		t.Errorf("subscription recorded out of stream [n:%v]", len(s.LoadSubScribed()))
+	}
+	if n, _ := s.LoadRaidResult(); n != 0 {
+		t.Errorf("raid recorded out of stream [n:%v]", n)
+	}
+	if s.LoadGigantifiedEmoteTimes() != 0 || s.LoadMessageEffectTimes() != 0 {
+		t.Errorf("power ups recorded out of stream [emote:%v, effect:%v]", s.LoadGigantifiedEmoteTimes(), s.LoadMessageEffectTimes())
+	}
+}
+
+func TestTwitchStats_LoaderReturnsCopy(t *testing.T) {
+	sut := NewTwitchStats()
+	sut.StreamStarted()
+	sut.Cheer("user1", 10)
+
+	h := sut.LoadCheerHistory()
+	h["user2"] = BitsRecord{Bits: 100, Times: 1}
+	if _, exists := sut.LoadCheerHistory()["user2"]; exists {
+		t.Errorf("loader returned live map")
+	}
+
+	s := sut.Snapshot()
+	sut.Cheer("user1", 10)
+	if s.LoadCheerTotal() != 10 {
+		t.Errorf("snapshot changed after record [n:%v]", s.LoadCheerTotal())
+	}
+	sut.StreamFinished()
+}
+
+// go test -race で実行すること
+func TestTwitchStats_Concurrent(t *testing.T) {
+	sut := NewTwitchStats()
+	sut.StreamStarted()
+
+	var wg sync.WaitGroup
+	n := 100
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < n; i++ {
+			sut.Chat("user1", "hi")
+			sut.Cheer("user1", 1)
+			sut.ChannelPoint("user1", "title", 100, "")
+			sut.SubGift("user1", 1, SubTier1)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < n; i++ {
+			sut.Raid("user2", 1)
+			sut.Follow("user2")
+			sut.GigantifiedEmote("user2")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < n; i++ {
+			sut.LoadCheerHistory()
+			sut.LoadTopChatters(3)
+			sut.LoadRaidHistory()
+			_ = sut.String("", "")
+		}
+	}()
+	wg.Wait()
+
+	if sut.LoadCheerTotal() != n {
+		t.Errorf("invalid cheer total [n:%v]", sut.LoadCheerTotal())
+	}
+	if times, _ := sut.LoadRaidResult(); times != n {
+		t.Errorf("invalid raid times [n:%v]", times)
+	}
+	sut.StreamFinished()
+}
+
+func TestTwitchStats_Checkpoint(t *testing.T) {
+	dest := "checkpoint.test.json"
+	sut := NewTwitchStats()
+	sut.StreamStarted()
+	sut.Cheer("user1", 10)
+	sut.Chat("user1", "hi")
+
+	if err := SaveStatsCheckpoint(dest, sut); err != nil {
+		t.Errorf("save error [%v]", err.Error())
+	}
+	c, err := LoadStatsCheckpoint(dest)
+	if err != nil {
+		t.Fatalf("load error [%v]", err.Error())
+	}
+	restored := NewTwitchStats()
+	restored.Restore(c.Stats)
+	if !restored.IsStreaming() {
+		t.Errorf("streaming flag not restored")
+	}
+	if restored.LoadCheerTotal() != 10 || restored.LoadCheerHistory()["user1"].Bits != 10 {
+		t.Errorf("invalid restored cheer [n:%v]", restored.LoadCheerTotal())
+	}
+	if restored.LoadNChats() != 1 {
+		t.Errorf("invalid restored chat [n:%v]", restored.LoadNChats())
+	}
+	restored.Cheer("user2", 1)
+	if restored.LoadCheerTotal() != 11 {
+		t.Errorf("cant record after restore [n:%v]", restored.LoadCheerTotal())
+	}
+	os.Remove(dest)
+}
+
+func TestTwitchStats_Export(t *testing.T) {
+	sut := NewTwitchStats()
+	sut.StreamStarted()
+	sut.Cheer("user1", 10)
+	sut.Cheer("user2", 100)
+	sut.Chat("user1", "hi")
+	sut.Emote("1", "Kappa")
+	sut.SubScribe("user3", "1000")
+	sut.StreamFinished()
+
+	e := BuildStatsExport(sut)
+	if e.SchemaVersion != StatsExportSchemaVersion {
+		t.Errorf("invalid schema version [%v]", e.SchemaVersion)
+	}
+	if e.Cheers.TotalBits != 110 || len(e.Cheers.Users) != 2 || e.Cheers.Users[0].User != "user2" {
+		t.Errorf("invalid cheers [%v]", e.Cheers)
+	}
+	if e.Chat.Total != 1 || e.Chat.UniqueChatters != 1 || len(e.Chat.Emotes) != 1 {
+		t.Errorf("invalid chat [%v]", e.Chat)
+	}
+	tables := e.CsvTables()
+	if rows := tables["cheers"]; len(rows) != 3 || rows[1][0] != "user2" || rows[1][1] != "100" {
+		t.Errorf("invalid cheers csv [%v]", rows)
+	}
+	if rows := tables["subscriptions"]; len(rows) != 2 || rows[1][1] != "1000" {
+		t.Errorf("invalid subscriptions csv [%v]", rows)
+	}
+}
+
+func TestTwitchStats_Render(t *testing.T) {
+	sut := NewTwitchStats()
+	sut.StreamStarted()
+	sut.Cheer("user1", 10)
+	sut.Cheer("user2", 100)
+	sut.ChannelPoint("user1", "title", 100, "")
+	sut.StreamFinished()
+
+	tmpl := `{{range sortByBits .Stats.LoadCheerHistory}}{{.User}}:{{.Bits}},{{end}}` +
+		`{{range sortByCount .Stats.LoadChannelPointHistory}}{{$.NamePrefix}}{{.User}}{{end}}`
+	ret, err := sut.Render(tmpl, "", "@")
+	if err != nil {
+		t.Fatalf("render error [%v]", err.Error())
+	}
+	if ret != "user2:100,user1:10,@user1" {
+		t.Errorf("invalid render result [%v]", ret)
+	}
+	if _, err := sut.Render("{{.Unknown}}", "", ""); err == nil {
+		t.Errorf("no error for invalid template")
+	}
+	if sut.String("  ", "- ") == "" {
+		t.Errorf("default template rendered nothing")
+	}
+}
+
+func TestTwitchStats_RenderOrdered(t *testing.T) {
+	sut := NewTwitchStats()
+	sut.StreamStarted()
+	sut.Cheer("bob", 10)
+	sut.Cheer("carol", 100)
+	sut.Cheer("alice", 10)
+	sut.StreamFinished()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sut.CheerStats.FirstAt["bob"] = base
+	sut.CheerStats.FirstAt["carol"] = base.Add(time.Minute)
+	sut.CheerStats.FirstAt["alice"] = base.Add(2 * time.Minute)
+
+	tmpl := `{{range .Cheers}}{{.User}},{{end}}`
+	tests := []struct {
+		order SummaryOrder
+		want  string
+	}{
+		{SummaryOrder{}, "carol,bob,alice,"},
+		{SummaryOrder{Default: SummaryOrderTime}, "bob,carol,alice,"},
+		{SummaryOrder{Default: SummaryOrderName}, "alice,bob,carol,"},
+		{SummaryOrder{Default: SummaryOrderTime, Sections: map[string]string{SummarySectionCheer: SummaryOrderName}}, "alice,bob,carol,"},
+		{SummaryOrder{Default: "unknown"}, "carol,bob,alice,"},
+	}
+	for _, tt := range tests {
+		ret, err := sut.RenderOrdered(tmpl, "", "", tt.order)
+		if err != nil {
+			t.Fatalf("render error [%v]", err.Error())
+		}
+		if ret != tt.want {
+			t.Errorf("invalid order %v: [%v] want [%v]", tt.order, ret, tt.want)
+		}
+	}
+}
+
+func TestTwitchStats_SubTiers(t *testing.T) {
+	sut := NewTwitchStats()
+	sut.StreamStarted()
+	sut.SubScribe("user1", SubTier1)
+	sut.SubScribe("user2", SubTier3)
+	sut.SubScribe("user3", SubTierPrime)
+	// Prime判明後に届いたtier(1000)では上書きしない
+	sut.ReSubScribe("user3", SubTier1, 12, 3, 1)
+	sut.ReSubScribe("user4", SubTier2, 5, 0, 1)
+	sut.SubGift("user5", 5, SubTier1)
+	sut.SubGifted("user6", SubTier1)
+	sut.StreamFinished()
+
+	subs := sut.LoadSubScribed()
+	if e := subs["user3"]; e.Tier != SubTierPrime || !e.ReSub || e.CumulativeMonths != 12 || e.StreakMonths != 3 {
+		t.Errorf("invalid resub entry [%v]", e)
+	}
+	want := []SubTierBreakdown{
+		{Tier: SubTier1, Subs: 1, Gifts: 5, Points: 6},
+		{Tier: SubTier2, ReSubs: 1, Points: 2},
+		{Tier: SubTier3, Subs: 1, Points: 6},
+		{Tier: SubTierPrime, ReSubs: 1, Points: 1},
+	}
+	if ret := sut.LoadSubTierBreakdown(); !slices.Equal(ret, want) {
+		t.Errorf("invalid breakdown [%v]", ret)
+	}
+	if n := sut.LoadSubPoints(); n != 15 {
+		t.Errorf("invalid sub points [%v]", n)
+	}
+	e := BuildStatsExport(sut)
+	if e.SubPoints != 15 || len(e.SubTiers) != 4 {
+		t.Errorf("invalid export [%v, %v]", e.SubPoints, e.SubTiers)
+	}
+	if rows := e.CsvTables()["sub_tiers"]; len(rows) != 5 || rows[1][4] != "6" {
+		t.Errorf("invalid sub_tiers csv [%v]", rows)
+	}
+}
+
+func TestTwitchStats_Rewards(t *testing.T) {
+	sut := NewTwitchStats()
+	sut.StreamStarted()
+	sut.ChannelPoint("user1", "hydrate", 100, "")
+	sut.ChannelPoint("user2", "hydrate", 100, "")
+	sut.ChannelPoint("user1", "hydrate", 100, "")
+	sut.ChannelPoint("user2", "song", 500, "曲名")
+	sut.StreamFinished()
+
+	if n := sut.LoadChannelPointCost(); n != 800 {
+		t.Errorf("invalid total cost [%v]", n)
+	}
+	r := sut.LoadChannelPointRewards()
+	if v := r["hydrate"]; v.Times != 3 || v.Cost != 300 || v.Users["user1"] != 2 || len(v.Inputs) != 0 {
+		t.Errorf("invalid reward record [%v]", v)
+	}
+	if v := r["song"]; len(v.Inputs) != 1 || v.Inputs[0].User != "user2" || v.Inputs[0].Text != "曲名" {
+		t.Errorf("invalid reward input [%v]", v)
+	}
+	// コピーを返すこと
+	r["hydrate"].Users["user1"] = 100
+	if sut.LoadChannelPointRewards()["hydrate"].Users["user1"] != 2 {
+		t.Errorf("loader returned shared map")
+	}
+
+	tmpl := `{{range .Rewards}}{{.Title}}:{{.Cost}}[{{range .Users}}{{.User}}{{end}}]{{range .Inputs}}{{.Text}}{{end}},{{end}}`
+	ret, err := sut.Render(tmpl, "", "")
+	if err != nil {
+		t.Fatalf("render error [%v]", err.Error())
+	}
+	if ret != "hydrate:300[user1user2],song:500[user2]曲名," {
+		t.Errorf("invalid render result [%v]", ret)
+	}
+	if rows := BuildStatsExport(sut).CsvTables()["reward_inputs"]; len(rows) != 2 || rows[1][3] != "曲名" {
+		t.Errorf("invalid reward_inputs csv [%v]", rows)
+	}
+}
+
+func TestTwitchStats_RewardUserFirst(t *testing.T) {
+	sut := NewTwitchStats()
+	sut.StreamStarted()
+	// user1 は別の報酬を先に使っているが、song では user2 が先
+	for _, r := range []struct {
+		user  UserName
+		title ChannelPointTitle
+	}{{"user1", "hydrate"}, {"user2", "song"}, {"user1", "song"}} {
+		sut.ChannelPoint(r.user, r.title, 100, "")
+		time.Sleep(time.Millisecond)
+	}
+	sut.StreamFinished()
+
+	tmpl := `{{range .Rewards}}{{.Title}}[{{range .Users}}{{.User}}{{end}}],{{end}}`
+	order := SummaryOrder{Default: SummaryOrderTime}
+	ret, err := sut.RenderOrdered(tmpl, "", "", order)
+	if err != nil {
+		t.Fatalf("render error [%v]", err.Error())
+	}
+	if ret != "hydrate[user1],song[user2user1]," {
+		t.Errorf("invalid render result [%v]", ret)
+	}
+}
+
+func TestFirstChatOnlyInStream(t *testing.T) {
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	statsLogger = logger
+	ctx := &BackendContext{
+		Chatters: LoadKnownChatters(filepath.Join(t.TempDir(), "chatters.txt")),
+		Overlay:  NewOverlay(nil),
+	}
+	s := NewTwitchStats()
+	raw := []byte(`{"payload":{"event":{"chatter_user_login":"tom","chatter_user_name":"tom","message":{"text":"hi"}}}}`)
+
+	// 配信外のチャットでは既知にしない
+	handleNotificationChannelChatMessage(ctx, nil, &Responce{}, raw, s)
+	if _, exists := ctx.Chatters.Users["tom"]; exists {
+		t.Errorf("known before stream")
+	}
+	s.StreamStarted()
+	handleNotificationChannelChatMessage(ctx, nil, &Responce{}, raw, s)
+	if first := s.LoadFirstTimeChatters(); len(first) != 1 || first[0] != "tom" {
+		t.Errorf("invalid first time chatters [%v]", first)
+	}
+	s.StreamFinished()
+}
+
+func TestRestoreStatsCheckpoint(t *testing.T) {
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	statsLogger = logger
+	defer func() { referStreamStartedAt = ReferStreamStartedAt }()
+	cfg := &Config{}
+	cfg.Init()
+	cfg.Body.LogDest = t.TempDir()
+
+	prev := NewTwitchStats()
+	prev.StreamStarted()
+	prev.Cheer("user1", 10)
+	streamStarted := prev.LastPeriod.Started.Add(-time.Minute)
+
+	cases := []struct {
+		name     string
+		started  time.Time
+		err      error
+		restored bool
+	}{
+		{"same stream", streamStarted, nil, true},
+		{"offline", time.Time{}, nil, false},
+		{"new stream", time.Now().Add(time.Hour), nil, false},
+		{"helix error", time.Time{}, os.ErrDeadlineExceeded, false},
+	}
+	for _, c := range cases {
+		if err := SaveStatsCheckpoint(cfg.StatsCheckpointFullPath(), prev); err != nil {
+			t.Fatal(err)
+		}
+		os.Remove(cfg.StatsLogFullPath())
+		referStreamStartedAt = func(*Config, string) (time.Time, error) { return c.started, c.err }
+		sut := NewTwitchStats()
+		RestoreStatsCheckpoint(cfg, sut)
+
+		if sut.IsStreaming() != c.restored || (c.restored && sut.LoadCheerTotal() != 10) {
+			t.Errorf("%v: invalid restore [streaming:%v cheer:%v]", c.name, sut.IsStreaming(), sut.LoadCheerTotal())
+		}
+		_, err := os.Stat(cfg.StatsCheckpointFullPath())
+		if kept := err == nil; kept != c.restored {
+			t.Errorf("%v: checkpoint kept [%v]", c.name, kept)
+		}
+		_, err = os.Stat(cfg.StatsLogFullPath())
+		if written := err == nil; written == c.restored {
+			t.Errorf("%v: summary written [%v]", c.name, written)
+		}
+	}
+}
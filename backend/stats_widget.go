@@ -0,0 +1,95 @@
+package backend
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+)
+
+const StatsOverlayEvent = "stats"
+
+// ウィジェットに出す今の配信の集計
+type StatsWidgets struct {
+	Streaming      bool     `json:"streaming"`
+	LatestFollower UserName `json:"latest_follower"`
+	LatestSub      UserName `json:"latest_sub"`
+	LatestSubTier  string   `json:"latest_sub_tier"`
+	TopCheerer     UserName `json:"top_cheerer"`
+	TopCheererBits int      `json:"top_cheerer_bits"`
+	Followers      int      `json:"followers"`
+	Subs           int      `json:"subs"` // 新規+継続+贈られたギフトの個数
+	Bits           int      `json:"bits"`
+	SubPoints      int      `json:"sub_points"`
+	SubGoal        int      `json:"sub_goal"`
+}
+
+// ?w=follower|sub|cheerer|counters|goal で出すウィジェットを選ぶ
+//
+//go:embed overlay/widgets.html
+var WidgetsHtml string
+
+func BuildStatsWidgets(s *TwitchStats, goal int) *StatsWidgets {
+	s = s.Snapshot()
+	ret := &StatsWidgets{
+		Streaming: s.InStreaming,
+		Followers: len(s.FollowStats.Users),
+		Subs:      len(s.SubScriptionStats.Entry) + s.SubGiftStats.TotalGifts,
+		Bits:      s.CheerStats.TotalBits,
+		SubPoints: s.LoadSubPoints(),
+		SubGoal:   goal,
+	}
+	if n := len(s.FollowStats.Users); n > 0 {
+		ret.LatestFollower = s.FollowStats.Users[n-1]
+	}
+	for user, e := range s.SubScriptionStats.Entry {
+		latest := s.SubScriptionStats.Entry[ret.LatestSub]
+		if ret.LatestSub == "" || e.First.After(latest.First) {
+			ret.LatestSub = user
+			ret.LatestSubTier = e.Tier
+		}
+	}
+	// 同じビッツなら先にcheerした人
+	for user, r := range s.CheerStats.History {
+		if r.Bits > ret.TopCheererBits ||
+			(r.Bits == ret.TopCheererBits && s.CheerStats.FirstAt[user].Before(s.CheerStats.FirstAt[ret.TopCheerer])) {
+			ret.TopCheerer = user
+			ret.TopCheererBits = r.Bits
+		}
+	}
+	return ret
+}
+
+func (o *OverlayContext) statsWidgets() *StatsWidgets {
+	goal := DefaultConfig.SubGoalPoints
+	if o.Config != nil {
+		goal = o.Config.SubGoal()
+	}
+	return BuildStatsWidgets(o.Stats, goal)
+}
+
+// 記録が変わるたびにオーバーレイへ送る
+// 続けて変わったときはまとめて1回だけ送る
+func (o *OverlayContext) WatchStats(s *TwitchStats) {
+	o.Stats = s
+	ch := make(chan struct{}, 1)
+	s.SetOnChanged(func() {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	})
+	go func() {
+		for range ch {
+			o.Hub.Publish(StatsOverlayEvent, o.statsWidgets())
+		}
+	}()
+}
+
+func (o *OverlayContext) OnStats(w http.ResponseWriter, r *http.Request) {
+	if o.Stats == nil {
+		http.Error(w, "stats not ready", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(o.statsWidgets())
+}
@@ -0,0 +1,58 @@
+package backend
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestBuildStatsWidgets(t *testing.T) {
+	s := NewTwitchStats()
+	s.StreamStarted()
+	s.Follow("alice")
+	s.Follow("bob")
+	s.SubScribe("carol", SubTier1)
+	time.Sleep(time.Millisecond)
+	s.ReSubScribe("dave", SubTier3, 5, 5, 1)
+	s.SubGift("erin", 3, SubTier1)
+	s.Cheer("frank", 100)
+	s.Cheer("grace", 300)
+	s.Cheer("frank", 200)
+
+	w := BuildStatsWidgets(s, 20)
+	if w.LatestFollower != "bob" || w.LatestSub != "dave" || w.LatestSubTier != SubTier3 {
+		t.Errorf("invalid latest [%v] [%v] [%v]", w.LatestFollower, w.LatestSub, w.LatestSubTier)
+	}
+	// 同じビッツなら先にcheerした人
+	if w.TopCheerer != "frank" || w.TopCheererBits != 300 {
+		t.Errorf("invalid top cheerer [%v] [%v]", w.TopCheerer, w.TopCheererBits)
+	}
+	if w.Followers != 2 || w.Subs != 5 || w.Bits != 600 || w.SubPoints != 10 || w.SubGoal != 20 {
+		t.Errorf("invalid counters [%+v]", w)
+	}
+}
+
+func TestWatchStats(t *testing.T) {
+	cfg := &Config{}
+	cfg.Init()
+	s := NewTwitchStats()
+	sut := NewOverlay(cfg)
+	c, _ := sut.Hub.Subscribe([]string{StatsOverlayEvent}, 0)
+	sut.WatchStats(s)
+
+	s.StreamStarted()
+	s.Follow("alice")
+	deadline := time.After(time.Second)
+	for {
+		select {
+		case m := <-c.ch:
+			w := &StatsWidgets{}
+			json.Unmarshal(m.Data, w)
+			if w.LatestFollower == "alice" {
+				return
+			}
+		case <-deadline:
+			t.Fatalf("stats not published")
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package backend
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	SubscriptionEnabled = "enabled"
+	SubscriptionFailed  = "failed"
+	SubscriptionRevoked = "revoked"
+)
+
+type SubscriptionEntry struct {
+	Type      string    `json:"type"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// EventSubの購読状況(制御APIから参照する)
+type SubscriptionStatus struct {
+	mu      sync.Mutex
+	session string
+	entries map[string]SubscriptionEntry
+}
+
+type SubscriptionReport struct {
+	Session string              `json:"session"`
+	Entries []SubscriptionEntry `json:"entries"`
+}
+
+func NewSubscriptionStatus() *SubscriptionStatus {
+	return &SubscriptionStatus{
+		entries: map[string]SubscriptionEntry{},
+	}
+}
+
+// 接続し直したら前のセッションの分は捨てる
+func (s *SubscriptionStatus) Connected(session string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.session = session
+	s.entries = map[string]SubscriptionEntry{}
+}
+
+func (s *SubscriptionStatus) Set(subscType, status string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := SubscriptionEntry{Type: subscType, Status: status, UpdatedAt: time.Now()}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	s.entries[subscType] = e
+}
+
+func (s *SubscriptionStatus) Report() SubscriptionReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ret := SubscriptionReport{Session: s.session, Entries: []SubscriptionEntry{}}
+	for _, e := range s.entries {
+		ret.Entries = append(ret.Entries, e)
+	}
+	sort.Slice(ret.Entries, func(i, j int) bool {
+		return ret.Entries[i].Type < ret.Entries[j].Type
+	})
+	return ret
+}
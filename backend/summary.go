@@ -0,0 +1,355 @@
+package backend
+
+import (
+	_ "embed"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// 配信履歴.txtに書き出す内容のテンプレート(text/template)
+// 設定でファイルを指定しなければこれを使う
+//
+//go:embed summary.tmpl
+var DefaultSummaryTemplate string
+
+// テンプレートに渡すデータ
+// Statsは記録中の統計のコピーなので Load* 系のメソッドも呼べる
+type SummaryData struct {
+	Stats      *TwitchStats
+	TopIndent  string
+	NamePrefix string
+	TopN       int
+	Order      SummaryOrder
+}
+
+// 配信履歴の各項目の並び順
+const (
+	SummaryOrderCount = "count" // 回数(ビッツ、視聴者数)の多い順
+	SummaryOrderTime  = "time"  // 最初に記録した順
+	SummaryOrderName  = "name"  // ユーザ名順
+)
+
+// 項目ごとの並び順を指定するときのキー
+const (
+	SummarySectionFollow           = "follow"
+	SummarySectionChat             = "chat"
+	SummarySectionFirstChat        = "first_chat"
+	SummarySectionChannelPoint     = "channel_point"
+	SummarySectionReward           = "reward"
+	SummarySectionRewardUser       = "reward_user"
+	SummarySectionSubscription     = "subscription"
+	SummarySectionSubGift          = "sub_gift"
+	SummarySectionSubGifted        = "sub_gifted"
+	SummarySectionCheer            = "cheer"
+	SummarySectionRaid             = "raid"
+	SummarySectionGigantifiedEmote = "gigantified_emote"
+	SummarySectionMessageEffect    = "message_effect"
+)
+
+// Sectionsに無い項目はDefaultで並べる
+type SummaryOrder struct {
+	Default  string
+	Sections map[string]string
+}
+
+func (o SummaryOrder) Of(section string) string {
+	if v, exists := o.Sections[section]; exists && isSummaryOrder(v) {
+		return v
+	}
+	if isSummaryOrder(o.Default) {
+		return o.Default
+	}
+	return SummaryOrderCount
+}
+
+func isSummaryOrder(v string) bool {
+	switch v {
+	case SummaryOrderCount, SummaryOrderTime, SummaryOrderName:
+		return true
+	}
+	return false
+}
+
+// 並び替えた各項目の1行分
+// Countは回数順に並べるときに使う値(ビッツならビッツ数、レイドなら視聴者数)
+type SummaryEntry struct {
+	User    UserName
+	Count   int
+	Times   int
+	Bits    int
+	Viewers int
+	Tier    string
+	ReSub   bool
+	Months  int // 累計月数
+	Streak  int // 連続月数
+	First   time.Time
+}
+
+// どの並び順でも同じ値同士は 最初に記録した順 -> ユーザ名順 で並べて結果を固定する
+func sortEntries(l []SummaryEntry, order string) []SummaryEntry {
+	byTime := func(a, b SummaryEntry) int {
+		if c := a.First.Compare(b.First); c != 0 {
+			return c
+		}
+		return strings.Compare(string(a.User), string(b.User))
+	}
+	byName := func(a, b SummaryEntry) int {
+		if c := strings.Compare(string(a.User), string(b.User)); c != 0 {
+			return c
+		}
+		return a.First.Compare(b.First)
+	}
+	switch order {
+	case SummaryOrderTime:
+		slices.SortStableFunc(l, byTime)
+	case SummaryOrderName:
+		slices.SortStableFunc(l, byName)
+	default:
+		slices.SortStableFunc(l, func(a, b SummaryEntry) int {
+			if a.Count != b.Count {
+				return b.Count - a.Count
+			}
+			return byTime(a, b)
+		})
+	}
+	return l
+}
+
+func countEntries(m map[UserName]int, first map[UserName]time.Time) []SummaryEntry {
+	ret := []SummaryEntry{}
+	for k, v := range m {
+		ret = append(ret, SummaryEntry{User: k, Count: v, Times: v, First: first[k]})
+	}
+	return ret
+}
+
+func (d *SummaryData) Follows() []SummaryEntry {
+	ret := []SummaryEntry{}
+	for _, v := range d.Stats.FollowStats.Users {
+		ret = append(ret, SummaryEntry{User: v, Count: 1, Times: 1, First: d.Stats.FollowStats.FirstAt[v]})
+	}
+	return sortEntries(ret, d.Order.Of(SummarySectionFollow))
+}
+
+// 回数上位TopN人を選んでから並び替える
+func (d *SummaryData) TopChatters() []SummaryEntry {
+	ret := []SummaryEntry{}
+	for _, v := range d.Stats.LoadTopChatters(d.TopN) {
+		ret = append(ret, SummaryEntry{User: v.User, Count: v.Times, Times: v.Times, First: d.Stats.ChatStats.FirstAt[v.User]})
+	}
+	return sortEntries(ret, d.Order.Of(SummarySectionChat))
+}
+
+func (d *SummaryData) FirstTimeChatters() []SummaryEntry {
+	ret := []SummaryEntry{}
+	for _, v := range d.Stats.ChatStats.FirstTime {
+		n := d.Stats.ChatStats.Chatters[v]
+		ret = append(ret, SummaryEntry{User: v, Count: n, Times: n, First: d.Stats.ChatStats.FirstAt[v]})
+	}
+	return sortEntries(ret, d.Order.Of(SummarySectionFirstChat))
+}
+
+func (d *SummaryData) ChannelPoints() []SummaryEntry {
+	s := d.Stats.ChannelPoinsts
+	return sortEntries(countEntries(s.Record, s.FirstAt), d.Order.Of(SummarySectionChannelPoint))
+}
+
+// 報酬ごとの集計
+// Usersは報酬を使った人、Inputsは入力内容(入力された順)
+type SummaryReward struct {
+	Title  ChannelPointTitle
+	Times  int
+	Cost   int
+	Users  []SummaryEntry
+	Inputs []RewardInput
+}
+
+// 報酬の並びはSummaryEntryと同じ規則(Userに報酬名を入れて並べる)
+func (d *SummaryData) Rewards() []SummaryReward {
+	l := []SummaryEntry{}
+	for k, v := range d.Stats.ChannelPoinsts.Rewards {
+		l = append(l, SummaryEntry{User: UserName(k), Count: v.Times, Times: v.Times, First: v.First})
+	}
+	ret := []SummaryReward{}
+	for _, e := range sortEntries(l, d.Order.Of(SummarySectionReward)) {
+		v := d.Stats.ChannelPoinsts.Rewards[ChannelPointTitle(e.User)]
+		users := []SummaryEntry{}
+		for k, n := range v.Users {
+			users = append(users, SummaryEntry{User: k, Count: n, Times: n, First: v.FirstAt[k]})
+		}
+		ret = append(ret, SummaryReward{
+			Title:  ChannelPointTitle(e.User),
+			Times:  v.Times,
+			Cost:   v.Cost,
+			Users:  sortEntries(users, d.Order.Of(SummarySectionRewardUser)),
+			Inputs: v.Inputs,
+		})
+	}
+	return ret
+}
+
+func (d *SummaryData) Subscriptions() []SummaryEntry {
+	ret := []SummaryEntry{}
+	for k, v := range d.Stats.SubScriptionStats.Entry {
+		ret = append(ret, SummaryEntry{
+			User:   k,
+			Count:  v.CumulativeMonths,
+			Times:  1,
+			Tier:   v.Tier,
+			ReSub:  v.ReSub,
+			Months: v.CumulativeMonths,
+			Streak: v.StreakMonths,
+			First:  v.First,
+		})
+	}
+	return sortEntries(ret, d.Order.Of(SummarySectionSubscription))
+}
+
+func (d *SummaryData) SubGifts() []SummaryEntry {
+	s := d.Stats.SubGiftStats
+	return sortEntries(countEntries(s.History, s.FirstAt), d.Order.Of(SummarySectionSubGift))
+}
+
+func (d *SummaryData) SubGifted() []SummaryEntry {
+	s := d.Stats.SubGiftReceived
+	return sortEntries(countEntries(s.History, s.FirstAt), d.Order.Of(SummarySectionSubGifted))
+}
+
+func (d *SummaryData) Cheers() []SummaryEntry {
+	ret := []SummaryEntry{}
+	for k, v := range d.Stats.CheerStats.History {
+		ret = append(ret, SummaryEntry{User: k, Count: v.Bits, Times: v.Times, Bits: v.Bits, First: d.Stats.CheerStats.FirstAt[k]})
+	}
+	return sortEntries(ret, d.Order.Of(SummarySectionCheer))
+}
+
+func (d *SummaryData) Raids() []SummaryEntry {
+	ret := []SummaryEntry{}
+	for _, v := range d.Stats.RaidStats.History {
+		ret = append(ret, SummaryEntry{User: v.From, Count: v.Viewers, Times: 1, Viewers: v.Viewers, First: v.Time})
+	}
+	return sortEntries(ret, d.Order.Of(SummarySectionRaid))
+}
+
+func (d *SummaryData) GigantifiedEmotes() []SummaryEntry {
+	s := d.Stats.PowerUpStats.GigantifiedEmoteHistory
+	return sortEntries(countEntries(s.History, s.FirstAt), d.Order.Of(SummarySectionGigantifiedEmote))
+}
+
+func (d *SummaryData) MessageEffects() []SummaryEntry {
+	s := d.Stats.PowerUpStats.MessegeEffectHistory
+	return sortEntries(countEntries(s.History, s.FirstAt), d.Order.Of(SummarySectionMessageEffect))
+}
+
+type UserBits struct {
+	User  UserName
+	Bits  int
+	Times int
+}
+
+// 回数の多い順、同数ならユーザ名順
+func sortByCount(m map[UserName]int) []UserCount {
+	ret := []UserCount{}
+	for k, v := range m {
+		ret = append(ret, UserCount{User: k, Times: v})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Times != ret[j].Times {
+			return ret[i].Times > ret[j].Times
+		}
+		return ret[i].User < ret[j].User
+	})
+	return ret
+}
+
+// ビッツの多い順、同数ならユーザ名順
+func sortByBits(m map[UserName]BitsRecord) []UserBits {
+	ret := []UserBits{}
+	for k, v := range m {
+		ret = append(ret, UserBits{User: k, Bits: v.Bits, Times: v.Times})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Bits != ret[j].Bits {
+			return ret[i].Bits > ret[j].Bits
+		}
+		return ret[i].User < ret[j].User
+	})
+	return ret
+}
+
+func subTierName(tier string) string {
+	switch tier {
+	case SubTier1:
+		return "Tier1"
+	case SubTier2:
+		return "Tier2"
+	case SubTier3:
+		return "Tier3"
+	}
+	return tier
+}
+
+var summaryFuncs = template.FuncMap{
+	"sortByCount": sortByCount,
+	"sortByBits":  sortByBits,
+	"tierName":    subTierName,
+	"formatTime": func(t time.Time) string {
+		return t.Format("2006/01/02 15:04:05")
+	},
+	"formatClock": func(t time.Time) string {
+		return t.Format("15:04")
+	},
+}
+
+func (t *TwitchStats) Render(tmpl, topIndent, namePrefix string) (string, error) {
+	return t.RenderOrdered(tmpl, topIndent, namePrefix, SummaryOrder{})
+}
+
+func (t *TwitchStats) RenderOrdered(tmpl, topIndent, namePrefix string, order SummaryOrder) (string, error) {
+	p, err := template.New("summary").Funcs(summaryFuncs).Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	data := &SummaryData{
+		Stats:      t.Snapshot(),
+		TopIndent:  topIndent,
+		NamePrefix: namePrefix,
+		TopN:       ChatReportTopN,
+		Order:      order,
+	}
+	if err := p.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func (t *TwitchStats) renderFile(cfg *Config, path string) (string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return t.RenderOrdered(string(raw), cfg.TopIndent(), cfg.UserNamePrefix(), cfg.SummaryOrder())
+}
+
+// 設定されたテンプレートファイルで出力する
+// 読めない、または壊れている場合はデフォルトのテンプレートを使う
+func (t *TwitchStats) RenderWith(cfg *Config) string {
+	if path := cfg.SummaryTemplatePath(); path != "" {
+		ret, err := t.renderFile(cfg, path)
+		if err == nil {
+			return ret
+		}
+		logger.Error("RenderWith", slog.Any("template", path), slog.Any("ERR", err.Error()))
+	}
+	ret, err := t.RenderOrdered(DefaultSummaryTemplate, cfg.TopIndent(), cfg.UserNamePrefix(), cfg.SummaryOrder())
+	if err != nil {
+		return err.Error()
+	}
+	return ret
+}
@@ -31,8 +31,12 @@ var (
 		"channel.chat.message":         {"チャット", "1", buildRequestWithUser, handleNotificationChannelChatMessage},    // user:read:chat
 		"channel.raid":                 {"レイド開始", "1", buildRequestWithFromUser, handleNotificationRaidStarted},      // none
 		"channel.follow":               {"フォロー", "2", buildRequestWithModerator, handleNotificationChannelFollow},    // moderator:read:followers
-		"channel.channel_points_custom_reward_redemption.add":    {"チャネポ", "1", buildRequest, handleNotificationChannelPointsCustomRewardRedemptionAdd},     // channel:read:redemptions
-		"channel.channel_points_automatic_reward_redemption.add": {"チャネポ2", "1", buildRequest, handleNotificationChannelPointsAutomaticRewardRedemptionAdd}, // channel:read:redemptions
+		"channel.channel_points_custom_reward_redemption.add":    {"チャネポ", "1", buildRequest, handleNotificationChannelPointsCustomRewardRedemptionAdd},      // channel:read:redemptions
+		"channel.channel_points_automatic_reward_redemption.add": {"チャネポ2", "1", buildRequest, handleNotificationChannelPointsAutomaticRewardRedemptionAdd},  // channel:read:redemptions
+		"channel.channel_points_custom_reward_redemption.update": {"チャネポ更新", "1", buildRequest, handleNotificationChannelPointsCustomRewardRedemptionUpdate}, // channel:read:redemptions
+		"channel.chat.message_delete":                            {"チャット削除", "1", buildRequestWithUser, handleNotificationChannelChatMessageDelete},          // user:read:chat
+		"channel.chat.clear":                                     {"チャット全削除", "1", buildRequestWithUser, handleNotificationChannelChatClear},                 // user:read:chat
+		"channel.chat.clear_user_messages":                       {"ユーザーのチャット削除", "1", buildRequestWithUser, handleNotificationChannelChatClear},             // user:read:chat
 	}
 )
 
@@ -124,7 +128,7 @@ func handleNotificationDefault(_ *Config, r *Responce, _ []byte, _ *TwitchStats)
 	)
 }
 
-func handleNotificationChannelSubscribe(_ *BackendContext, _ *Config, r *Responce, raw []byte, s *TwitchStats) {
+func handleNotificationChannelSubscribe(ctx *BackendContext, _ *Config, r *Responce, raw []byte, s *TwitchStats) {
 	v := &ResponceChannelSubscribe{}
 	err := json.Unmarshal(raw, &v)
 	if err != nil {
@@ -147,10 +151,11 @@ func handleNotificationChannelSubscribe(_ *BackendContext, _ *Config, r *Responc
 			slog.Any("gift", e.IsGift),
 		)
 		s.SubScribe(UserName(e.UserName), e.Tier)
+		ctx.PushAlert(Alert{Event: AlertSub, User: e.UserName, Tier: e.Tier})
 	}
 }
 
-func handleNotificationChannelCheer(_ *BackendContext, _ *Config, r *Responce, raw []byte, s *TwitchStats) {
+func handleNotificationChannelCheer(ctx *BackendContext, _ *Config, r *Responce, raw []byte, s *TwitchStats) {
 	v := &ResponceChannelCheer{}
 	err := json.Unmarshal(raw, &v)
 	if err != nil {
@@ -165,9 +170,10 @@ func handleNotificationChannelCheer(_ *BackendContext, _ *Config, r *Responce, r
 		slog.Any("msg", e.Message),
 	)
 	s.Cheer(UserName(e.UserName), e.Bits)
+	ctx.PushAlert(Alert{Event: AlertCheer, User: e.UserName, Amount: e.Bits, Message: e.Message})
 }
 
-func handleNotificationStreamOnline(_ *BackendContext, cfg *Config, r *Responce, raw []byte, s *TwitchStats) {
+func handleNotificationStreamOnline(ctx *BackendContext, cfg *Config, r *Responce, raw []byte, s *TwitchStats) {
 	path := buildLogPath(cfg)
 	_, statsLogger = buildLogger(cfg, path)
 
@@ -177,6 +183,9 @@ func handleNotificationStreamOnline(_ *BackendContext, cfg *Config, r *Responce,
 		logger.Error("handleNotificationStreamOnline::Unmarshal", slog.Any("ERR", err.Error()), slog.Any("raw", string(raw)))
 	}
 	s.StreamStarted()
+	if err := ctx.History.StartSession(s.LoadPeriodStarted()); err != nil {
+		logger.Error("History::StartSession", slog.Any("ERR", err.Error()))
+	}
 	e := &v.Payload.Event
 	statsLogger.Info("event(Online)",
 		slog.Any(LogFieldName_Type, r.Payload.Subscription.Type),
@@ -184,9 +193,10 @@ func handleNotificationStreamOnline(_ *BackendContext, cfg *Config, r *Responce,
 		slog.Any("at", e.StartedAt),
 	)
 	os.Remove(cfg.RaidLogPath)
+	ctx.ApplyRewardSets(true)
 }
 
-func handleNotificationStreamOffline(_ *BackendContext, cfg *Config, r *Responce, raw []byte, s *TwitchStats) {
+func handleNotificationStreamOffline(ctx *BackendContext, cfg *Config, r *Responce, raw []byte, s *TwitchStats) {
 	v := &ResponceStreamOffline{}
 	err := json.Unmarshal(raw, &v)
 	if err != nil {
@@ -198,13 +208,17 @@ func handleNotificationStreamOffline(_ *BackendContext, cfg *Config, r *Responce
 		slog.Any(LogFieldName_UserName, e.BroadcasterUserName),
 	)
 	s.StreamFinished()
-	log, _ := os.OpenFile(cfg.StatsLogFullPath(), os.O_APPEND|os.O_RDWR|os.O_CREATE, 0666)
-	defer log.Close()
-	log.WriteString(s.String(cfg.TopIndent(), cfg.UserNamePrefix()))
+	if err := ctx.History.FinishSession(s.LoadPeriodStarted(), s.LoadPeriodFinished()); err != nil {
+		logger.Error("History::FinishSession", slog.Any("ERR", err.Error()))
+	}
+	ctx.PruneHistory()
+	writeStreamSummary(cfg, s)
+	DiscardStatsCheckpoint(cfg)
+	ctx.ApplyRewardSets(false)
 }
 
 // サブギフした
-func handleNotificationChannelSubscriptionGift(_ *BackendContext, _ *Config, r *Responce, raw []byte, s *TwitchStats) {
+func handleNotificationChannelSubscriptionGift(ctx *BackendContext, _ *Config, r *Responce, raw []byte, s *TwitchStats) {
 	v := &ResponceChannelSubscriptionGift{}
 	err := json.Unmarshal(raw, &v)
 	if err != nil {
@@ -220,11 +234,12 @@ func handleNotificationChannelSubscriptionGift(_ *BackendContext, _ *Config, r *
 		slog.Any("anonymous", e.IsAnonymous),
 	)
 
-	s.SubGift(UserName(e.UserName), e.Total)
+	s.SubGift(UserName(e.UserName), e.Total, e.Tier)
+	ctx.PushAlert(Alert{Event: AlertGift, User: e.UserName, Amount: e.Total, Tier: e.Tier})
 }
 
 // 継続サブスクをチャットでシェアした
-func handleNotificationChannelSubscriptionMessage(_ *BackendContext, _ *Config, r *Responce, raw []byte, s *TwitchStats) {
+func handleNotificationChannelSubscriptionMessage(ctx *BackendContext, _ *Config, r *Responce, raw []byte, s *TwitchStats) {
 	v := &ResponceChannelSubscriptionMessage{}
 	err := json.Unmarshal(raw, &v)
 	if err != nil {
@@ -239,10 +254,11 @@ func handleNotificationChannelSubscriptionMessage(_ *BackendContext, _ *Config,
 		slog.Any("streak", e.StreakMonths),
 		slog.Any("cumlative", e.CumulativeMonths),
 	)
-	s.SubScribe(UserName(e.UserName), e.Tier)
+	s.ReSubScribe(UserName(e.UserName), e.Tier, e.CumulativeMonths, e.StreakMonths, e.DurationMonths)
+	ctx.PushAlert(Alert{Event: AlertReSub, User: e.UserName, Tier: e.Tier, Months: e.CumulativeMonths, Message: e.Message.Text})
 }
 
-func handleNotificationChannelPointsCustomRewardRedemptionAdd(_ *BackendContext, _ *Config, r *Responce, raw []byte, s *TwitchStats) {
+func handleNotificationChannelPointsCustomRewardRedemptionAdd(ctx *BackendContext, _ *Config, r *Responce, raw []byte, s *TwitchStats) {
 	v := &ResponceChannelPointsCustomRewardRedemptionAdd{}
 	err := json.Unmarshal(raw, &v)
 	if err != nil {
@@ -254,8 +270,31 @@ func handleNotificationChannelPointsCustomRewardRedemptionAdd(_ *BackendContext,
 		slog.Any(LogFieldName_UserName, e.UserName),
 		slog.Any("login", e.UserLogin),
 		slog.Any("title", e.Reward.Title),
+		slog.Any("cost", e.Reward.Cost),
+		slog.Any("input", e.UserInput),
 	)
-	s.ChannelPoint(UserName(e.UserName), ChannelPointTitle(e.Reward.Title))
+	s.ChannelPoint(UserName(e.UserName), ChannelPointTitle(e.Reward.Title), e.Reward.Cost, e.UserInput)
+	redemption := toRedemption(e)
+	ctx.Redemptions.Add(redemption)
+	ctx.RunRewardActions(redemption)
+	ctx.PushAlert(Alert{Event: AlertRedemption, User: e.UserName, Amount: e.Reward.Cost, Message: e.UserInput, Reward: e.Reward.Title})
+}
+
+// 引き換えが承認/キャンセルされた(ダッシュボードなど他からの操作も含む)
+func handleNotificationChannelPointsCustomRewardRedemptionUpdate(ctx *BackendContext, _ *Config, r *Responce, raw []byte, s *TwitchStats) {
+	v := &ResponceChannelPointsCustomRewardRedemptionAdd{}
+	err := json.Unmarshal(raw, &v)
+	if err != nil {
+		logger.Error("handleNotificationChannelPointsCustomRewardRedemptionUpdate::Unmarshal", slog.Any("ERR", err.Error()), slog.Any("raw", string(raw)))
+	}
+	e := &v.Payload.Event
+	statsLogger.Info("event(Channel Points Update)",
+		slog.Any(LogFieldName_Type, r.Payload.Subscription.Type),
+		slog.Any(LogFieldName_UserName, e.UserName),
+		slog.Any("title", e.Reward.Title),
+		slog.Any("status", e.Status),
+	)
+	ctx.Redemptions.Update(e.Id, e.Status)
 }
 
 // TODO imple
@@ -286,6 +325,16 @@ func handleNotificationChannelChatNotificationSubGifted(_ *BackendContext, _ *Co
 	s.SubGifted(UserName(e.SubGift.RecipientUserName), e.SubGift.Sub_Tier)
 }
 
+// channel.subscribe などのtierではPrimeかどうか分からないのでここで上書きする
+func handleNotificationChannelChatNotificationPrimeSub(_ *BackendContext, _ *Config, r *Responce, e *EventFormatChannelChatNotification, s *TwitchStats) {
+	statsLogger.Info("event(PrimeSub)",
+		slog.Any(LogFieldName_Type, r.Payload.Subscription.Type),
+		slog.Any("category", e.NoticeType),
+		slog.Any(LogFieldName_UserName, e.ChatterUserName),
+	)
+	s.SubScribe(UserName(e.ChatterUserName), SubTierPrime)
+}
+
 func handleNotificationChannelChatNotificationRaid(ctx *BackendContext, cfg *Config, r *Responce, e *EventFormatChannelChatNotification, s *TwitchStats) {
 	statsLogger.Info("event(Raid)",
 		slog.Any(LogFieldName_Type, r.Payload.Subscription.Type),
@@ -294,6 +343,7 @@ func handleNotificationChannelChatNotificationRaid(ctx *BackendContext, cfg *Con
 		slog.Any("viewers", e.RaId.ViewerCount),
 	)
 	s.Raid(UserName(e.RaId.UserName), e.RaId.ViewerCount)
+	ctx.PushAlert(Alert{Event: AlertRaid, User: e.RaId.UserName, Amount: e.RaId.ViewerCount})
 	clipText, clips, err := ReferUserClips(cfg, e.RaId.UserId)
 	if err != nil {
 		statsLogger.Error("event(Raid)",
@@ -308,16 +358,9 @@ func handleNotificationChannelChatNotificationRaid(ctx *BackendContext, cfg *Con
 	log.WriteString(clipText)
 	p := &RaidCallbackParam{From: UserName(e.RaId.UserName), Clips: []UserClip{}}
 	for _, c := range clips.Data {
-		p.Clips = append(p.Clips, UserClip{
-			Id:        c.Id,
-			Url:       c.Url,
-			Thumbnail: c.ThumbnailUrl,
-			Title:     c.Title,
-			ViewCount: c.ViewCount,
-			Duration:  c.Duration,
-			Mp4:       ConvertThumbnailToMp4Url(c.ThumbnailUrl),
-		})
+		p.Clips = append(p.Clips, toUserClip(&c))
 	}
+	ctx.Overlay.ClipCache.Prefetch(p.Clips)
 	if ctx.CallBack.OnRaid != nil {
 		ctx.CallBack.OnRaid(p)
 	}
@@ -332,9 +375,15 @@ func handleNotificationChannelChatNotification(ctx *BackendContext, cfg *Config,
 	e := &v.Payload.Event
 	switch e.NoticeType {
 	case "sub":
+		if e.Sub.IsPrime {
+			handleNotificationChannelChatNotificationPrimeSub(ctx, cfg, r, e, s)
+		}
 	case "resub":
 		// サブスク継続をチャットで宣言したイベント
 		// channel.subscription.message も来るはずなのでそっちでハンドリングする
+		if e.Resub.IsPrime {
+			handleNotificationChannelChatNotificationPrimeSub(ctx, cfg, r, e, s)
+		}
 	case "sub_gift":
 		handleNotificationChannelChatNotificationSubGifted(ctx, cfg, r, e, s)
 	case "community_sub_gift":
@@ -352,7 +401,7 @@ func handleNotificationChannelChatNotification(ctx *BackendContext, cfg *Config,
 	}
 }
 
-func handleNotificationChannelChatMessage(_ *BackendContext, _ *Config, r *Responce, raw []byte, s *TwitchStats) {
+func handleNotificationChannelChatMessage(ctx *BackendContext, _ *Config, r *Responce, raw []byte, s *TwitchStats) {
 	v := &ResponceChatMessage{}
 	err := json.Unmarshal(raw, &v)
 	if err != nil {
@@ -368,6 +417,17 @@ func handleNotificationChannelChatMessage(_ *BackendContext, _ *Config, r *Respo
 		logType = "メッセージエフェクト"
 		s.MessageEffect(UserName(e.ChatterUserName))
 	}
+	s.Chat(UserName(e.ChatterUserName), e.Message.Text)
+	// 配信外のチャットで既知にすると、次の配信で初チャットに数えられない
+	if s.IsStreaming() && ctx.Chatters.Add(e.ChatterUserLogin) {
+		s.FirstChat(UserName(e.ChatterUserName))
+	}
+	for _, f := range e.Message.Fragments {
+		if f.Type == "emote" {
+			s.Emote(f.Emote.Id, f.Text)
+		}
+	}
+	ctx.PushChat(e)
 	statsLogger.Info("event(ChatMsg)",
 		slog.Any(LogFieldName_Type, logType),
 		slog.Any(LogFieldName_UserName, e.ChatterUserName),
@@ -376,7 +436,38 @@ func handleNotificationChannelChatMessage(_ *BackendContext, _ *Config, r *Respo
 	)
 }
 
-func handleNotificationChannelFollow(_ *BackendContext, _ *Config, r *Responce, raw []byte, s *TwitchStats) {
+func handleNotificationChannelChatMessageDelete(ctx *BackendContext, _ *Config, r *Responce, raw []byte, _ *TwitchStats) {
+	v := &ResponceChatMessageDelete{}
+	err := json.Unmarshal(raw, &v)
+	if err != nil {
+		logger.Error("handleNotificationChannelChatMessageDelete::Unmarshal", slog.Any("ERR", err.Error()), slog.Any("raw", string(raw)))
+	}
+	e := &v.Payload.Event
+	statsLogger.Info("event(Chat Delete)",
+		slog.Any(LogFieldName_Type, r.Payload.Subscription.Type),
+		slog.Any(LogFieldName_UserName, e.TargetUserName),
+		slog.Any(LogFieldName_LoginName, e.TargetUserLogin),
+	)
+	ctx.DeleteChat(e.MessageId)
+}
+
+// channel.chat.clear と channel.chat.clear_user_messages の両方
+func handleNotificationChannelChatClear(ctx *BackendContext, _ *Config, r *Responce, raw []byte, _ *TwitchStats) {
+	v := &ResponceChatClear{}
+	err := json.Unmarshal(raw, &v)
+	if err != nil {
+		logger.Error("handleNotificationChannelChatClear::Unmarshal", slog.Any("ERR", err.Error()), slog.Any("raw", string(raw)))
+	}
+	e := &v.Payload.Event
+	statsLogger.Info("event(Chat Clear)",
+		slog.Any(LogFieldName_Type, r.Payload.Subscription.Type),
+		slog.Any(LogFieldName_UserName, e.TargetUserName),
+		slog.Any(LogFieldName_LoginName, e.TargetUserLogin),
+	)
+	ctx.ClearChat(e.TargetUserLogin)
+}
+
+func handleNotificationChannelFollow(ctx *BackendContext, _ *Config, r *Responce, raw []byte, s *TwitchStats) {
 	v := &ResponceChannelFollow{}
 	err := json.Unmarshal(raw, &v)
 	if err != nil {
@@ -389,6 +480,7 @@ func handleNotificationChannelFollow(_ *BackendContext, _ *Config, r *Responce,
 		slog.Any(LogFieldName_LoginName, e.UserLogin),
 	)
 	s.Follow(UserName(e.UserName))
+	ctx.PushAlert(Alert{Event: AlertFollow, User: e.UserName})
 }
 
 func handleNotificationRaidStarted(_ *BackendContext, cfg *Config, r *Responce, raw []byte, _ *TwitchStats) {
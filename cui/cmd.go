@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"strconv"
 	"sttool/backend"
 )
 
@@ -14,6 +16,135 @@ func OnRaidCallback(_ *backend.RaidCallbackParam) {
 func OnConnectedCallback() {
 }
 
+func usage() {
+	fmt.Printf("usage: %v [command]\n", os.Args[0])
+	fmt.Printf("  rewards          : チャネポ一覧(デフォルト)\n")
+	fmt.Printf("  reward-create <title> <cost> [prompt]\n")
+	fmt.Printf("  reward-update <id> <title> <cost> [prompt]\n")
+	fmt.Printf("  reward-delete <id>\n")
+	fmt.Printf("  reward-pause|reward-resume <id>\n")
+	fmt.Printf("  reward-enable|reward-disable <id>\n")
+	fmt.Printf("  reward-set <name> on|off : 設定したチャネポセットの切り替え\n")
+	fmt.Printf("  user <login>     : ユーザの履歴\n")
+	fmt.Printf("  monthly          : 月ごとの集計\n")
+	fmt.Printf("  returning        : 最新の配信に来たリピーター\n")
+}
+
+func listRewards(b *backend.BackendContext) {
+	backend.ConfirmAccessToken(b.Config)
+	ret := b.ListChannelRewards()
+	for _, p := range ret {
+		fmt.Printf("title[%v] id[%v] enable[%v] paused[%v]\n", p.Title, p.Id, p.Enabled, p.Paused)
+	}
+}
+
+func findReward(b *backend.BackendContext, id string) (*backend.ChannelPoint, error) {
+	for _, p := range b.ListChannelRewards() {
+		if p.Id == id {
+			return &p, nil
+		}
+	}
+	return nil, backend.ErrRewardNotFound
+}
+
+// title cost [prompt] をpに反映する
+func applyRewardArgs(p *backend.ChannelPoint, args []string) error {
+	cost, err := strconv.Atoi(args[1])
+	if err != nil {
+		return err
+	}
+	p.Title = args[0]
+	p.Cost = cost
+	if len(args) > 2 {
+		p.Prompt = args[2]
+	}
+	return nil
+}
+
+// args: サブコマンド名を除いた引数
+func manageReward(b *backend.BackendContext, cmd string, args []string) error {
+	backend.ConfirmAccessToken(b.Config)
+	var err error
+	var p *backend.ChannelPoint
+	switch {
+	case cmd == "reward-create" && len(args) >= 2:
+		p = &backend.ChannelPoint{Enabled: true}
+		if err = applyRewardArgs(p, args); err != nil {
+			return err
+		}
+		p, err = b.CreateChannelReward(p)
+	case cmd == "reward-update" && len(args) >= 3:
+		if p, err = findReward(b, args[0]); err != nil {
+			return err
+		}
+		if err = applyRewardArgs(p, args[1:]); err != nil {
+			return err
+		}
+		p, err = b.UpdateChannelReward(p)
+	case cmd == "reward-set" && len(args) >= 2:
+		return b.ApplyRewardSet(args[0], args[1] == "on")
+	case cmd == "reward-delete" && len(args) >= 1:
+		return b.DeleteChannelReward(args[0])
+	case cmd == "reward-pause" && len(args) >= 1:
+		return b.PauseChannelReward(args[0], true)
+	case cmd == "reward-resume" && len(args) >= 1:
+		return b.PauseChannelReward(args[0], false)
+	case cmd == "reward-enable" && len(args) >= 1:
+		return b.EnableChannelReward(args[0], true)
+	case cmd == "reward-disable" && len(args) >= 1:
+		return b.EnableChannelReward(args[0], false)
+	default:
+		usage()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("title[%v] id[%v] cost[%v]\n", p.Title, p.Id, p.Cost)
+	return nil
+}
+
+func showUserHistory(b *backend.BackendContext, login string) error {
+	h, err := b.UserHistory(login)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("user[%v] login[%v]\n", h.Name, h.Login)
+	fmt.Printf("  first seen[%v] last seen[%v]\n", h.FirstSeen, h.LastSeen)
+	fmt.Printf("  first follow[%v]\n", h.FirstFollow)
+	fmt.Printf("  streams[%v] chats[%v] bits[%v] gifts[%v] redemptions[%v]\n", h.Streams, h.Chats, h.TotalBits, h.SubGifts, h.Redemptions)
+	for _, s := range h.Subs {
+		fmt.Printf("  sub at[%v] type[%v] tier[%v] months[%v] gift[%v]\n", s.Time, s.Type, s.Tier, s.Months, s.IsGift)
+	}
+	for _, r := range h.Raids {
+		fmt.Printf("  raid at[%v] viewers[%v]\n", r.Time, r.Viewers)
+	}
+	return nil
+}
+
+func showMonthlyTotals(b *backend.BackendContext) error {
+	ret, err := b.MonthlyTotals()
+	if err != nil {
+		return err
+	}
+	for _, m := range ret {
+		fmt.Printf("%v streams[%v] follows[%v] subs[%v] gifts[%v] bits[%v] raids[%v] chats[%v] redemptions[%v]\n",
+			m.Month, m.Streams, m.Follows, m.Subs, m.SubGifts, m.Bits, m.Raids, m.Chats, m.Redemptions)
+	}
+	return nil
+}
+
+func showReturningViewers(b *backend.BackendContext) error {
+	ret, err := b.ReturningViewers()
+	if err != nil {
+		return err
+	}
+	for _, login := range ret {
+		fmt.Println(login)
+	}
+	return nil
+}
+
 func main() {
 	callback := &backend.CallBack{
 		KeepAlive:   OnKeepAliveCallback,
@@ -21,9 +152,34 @@ func main() {
 		OnConnected: OnConnectedCallback,
 	}
 	b := backend.NewBackend(callback)
-	backend.ConfirmAccessToken(b.Config)
-	ret := b.ListChannelRewards()
-	for _, p := range ret {
-		fmt.Printf("title[%v] id[%v] enable[%v] paused[%v]\n", p.Title, p.Id, p.Enabled, p.Paused)
+	defer b.History.Close()
+
+	var err error
+	args := os.Args[1:]
+	if len(args) == 0 {
+		args = []string{"rewards"}
+	}
+	switch args[0] {
+	case "rewards":
+		listRewards(b)
+	case "reward-create", "reward-update", "reward-delete",
+		"reward-pause", "reward-resume", "reward-enable", "reward-disable", "reward-set":
+		err = manageReward(b, args[0], args[1:])
+	case "user":
+		if len(args) < 2 {
+			usage()
+			return
+		}
+		err = showUserHistory(b, args[1])
+	case "monthly":
+		err = showMonthlyTotals(b)
+	case "returning":
+		err = showReturningViewers(b)
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
 	}
 }
@@ -3,30 +3,84 @@
 import {main} from '../models';
 import {backend} from '../models';
 
+export function ApplyRewardSet(arg1:string,arg2:boolean):Promise<string>;
+
+export function CancelRedemption(arg1:string):Promise<string>;
+
+export function CreateChannelReward(arg1:backend.ChannelPoint):Promise<string>;
+
 export function DebugAppendEntry():Promise<void>;
 
 export function DebugRaidTest(arg1:string):Promise<void>;
 
+export function DeleteChannelReward(arg1:string):Promise<string>;
+
+export function EnableChannelReward(arg1:string,arg2:boolean):Promise<string>;
+
+export function ExportOverlayPages():Promise<string>;
+
+export function FulfillRedemption(arg1:string):Promise<string>;
+
+export function GetOverlayError():Promise<string>;
+
+export function GetPlayback():Promise<backend.PlaybackState>;
+
+export function GetPlaylist():Promise<backend.PlaylistState>;
+
+export function ListChannelRewards():Promise<Array<backend.ChannelPoint>>;
+
+export function ListRedemptions():Promise<Array<backend.Redemption>>;
+
 export function LoadConfig():Promise<main.AppConfig>;
 
+export function MonthlyTotals():Promise<Array<backend.MonthlyTotal>>;
+
 export function OnConnectedCallback():Promise<void>;
 
 export function OnKeepAliveCallback():Promise<void>;
 
+export function OnPlaybackCallback(arg1:backend.PlaybackState):Promise<void>;
+
+export function OnPlaylistCallback(arg1:string,arg2:backend.PlaylistState):Promise<void>;
+
 export function OnRaidCallback(arg1:backend.RaidCallbackParam):Promise<void>;
 
+export function OnRedemptionCallback(arg1:Array<backend.Redemption>):Promise<void>;
+
 export function OpenDiectoryDialog(arg1:string):Promise<string>;
 
 export function OpenFileDialog(arg1:string,arg2:string):Promise<string>;
 
 export function OpenURL(arg1:string):Promise<void>;
 
+export function PauseChannelReward(arg1:string,arg2:boolean):Promise<string>;
+
+export function PlaylistClear():Promise<void>;
+
+export function PlaylistNext():Promise<void>;
+
+export function PlaylistPrev():Promise<void>;
+
+export function PlaylistSkip():Promise<void>;
+
+export function QueueClips(arg1:Array<backend.UserClip>):Promise<void>;
+
+export function ReloadScripts():Promise<string>;
+
+export function ReturningViewers():Promise<Array<string>>;
+
 export function SaveConfig(arg1:main.AppConfig):Promise<void>;
 
 export function StartClip(arg1:string,arg2:number):Promise<void>;
 
+export function StartUserClip(arg1:backend.UserClip):Promise<void>;
+
 export function StopClip():Promise<void>;
 
 export function StopObsStream():Promise<void>;
 
 export function TestObsConnection():Promise<string>;
+
+export function UpdateChannelReward(arg1:backend.ChannelPoint):Promise<string>;
+
+export function UserHistory(arg1:string):Promise<backend.UserHistory>;
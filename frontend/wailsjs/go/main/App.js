@@ -2,6 +2,18 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function ApplyRewardSet(arg1, arg2) {
+  return window['go']['main']['App']['ApplyRewardSet'](arg1, arg2);
+}
+
+export function CancelRedemption(arg1) {
+  return window['go']['main']['App']['CancelRedemption'](arg1);
+}
+
+export function CreateChannelReward(arg1) {
+  return window['go']['main']['App']['CreateChannelReward'](arg1);
+}
+
 export function DebugAppendEntry() {
   return window['go']['main']['App']['DebugAppendEntry']();
 }
@@ -10,10 +22,50 @@ export function DebugRaidTest(arg1) {
   return window['go']['main']['App']['DebugRaidTest'](arg1);
 }
 
+export function DeleteChannelReward(arg1) {
+  return window['go']['main']['App']['DeleteChannelReward'](arg1);
+}
+
+export function EnableChannelReward(arg1, arg2) {
+  return window['go']['main']['App']['EnableChannelReward'](arg1, arg2);
+}
+
+export function ExportOverlayPages() {
+  return window['go']['main']['App']['ExportOverlayPages']();
+}
+
+export function FulfillRedemption(arg1) {
+  return window['go']['main']['App']['FulfillRedemption'](arg1);
+}
+
+export function GetOverlayError() {
+  return window['go']['main']['App']['GetOverlayError']();
+}
+
+export function GetPlayback() {
+  return window['go']['main']['App']['GetPlayback']();
+}
+
+export function GetPlaylist() {
+  return window['go']['main']['App']['GetPlaylist']();
+}
+
+export function ListChannelRewards() {
+  return window['go']['main']['App']['ListChannelRewards']();
+}
+
+export function ListRedemptions() {
+  return window['go']['main']['App']['ListRedemptions']();
+}
+
 export function LoadConfig() {
   return window['go']['main']['App']['LoadConfig']();
 }
 
+export function MonthlyTotals() {
+  return window['go']['main']['App']['MonthlyTotals']();
+}
+
 export function OnConnectedCallback() {
   return window['go']['main']['App']['OnConnectedCallback']();
 }
@@ -22,10 +74,22 @@ export function OnKeepAliveCallback() {
   return window['go']['main']['App']['OnKeepAliveCallback']();
 }
 
+export function OnPlaybackCallback(arg1) {
+  return window['go']['main']['App']['OnPlaybackCallback'](arg1);
+}
+
+export function OnPlaylistCallback(arg1, arg2) {
+  return window['go']['main']['App']['OnPlaylistCallback'](arg1, arg2);
+}
+
 export function OnRaidCallback(arg1) {
   return window['go']['main']['App']['OnRaidCallback'](arg1);
 }
 
+export function OnRedemptionCallback(arg1) {
+  return window['go']['main']['App']['OnRedemptionCallback'](arg1);
+}
+
 export function OpenDiectoryDialog(arg1) {
   return window['go']['main']['App']['OpenDiectoryDialog'](arg1);
 }
@@ -38,6 +102,38 @@ export function OpenURL(arg1) {
   return window['go']['main']['App']['OpenURL'](arg1);
 }
 
+export function PauseChannelReward(arg1, arg2) {
+  return window['go']['main']['App']['PauseChannelReward'](arg1, arg2);
+}
+
+export function PlaylistClear() {
+  return window['go']['main']['App']['PlaylistClear']();
+}
+
+export function PlaylistNext() {
+  return window['go']['main']['App']['PlaylistNext']();
+}
+
+export function PlaylistPrev() {
+  return window['go']['main']['App']['PlaylistPrev']();
+}
+
+export function PlaylistSkip() {
+  return window['go']['main']['App']['PlaylistSkip']();
+}
+
+export function QueueClips(arg1) {
+  return window['go']['main']['App']['QueueClips'](arg1);
+}
+
+export function ReloadScripts() {
+  return window['go']['main']['App']['ReloadScripts']();
+}
+
+export function ReturningViewers() {
+  return window['go']['main']['App']['ReturningViewers']();
+}
+
 export function SaveConfig(arg1) {
   return window['go']['main']['App']['SaveConfig'](arg1);
 }
@@ -46,6 +142,10 @@ export function StartClip(arg1, arg2) {
   return window['go']['main']['App']['StartClip'](arg1, arg2);
 }
 
+export function StartUserClip(arg1) {
+  return window['go']['main']['App']['StartUserClip'](arg1);
+}
+
 export function StopClip() {
   return window['go']['main']['App']['StopClip']();
 }
@@ -57,3 +157,11 @@ export function StopObsStream() {
 export function TestObsConnection() {
   return window['go']['main']['App']['TestObsConnection']();
 }
+
+export function UpdateChannelReward(arg1) {
+  return window['go']['main']['App']['UpdateChannelReward'](arg1);
+}
+
+export function UserHistory(arg1) {
+  return window['go']['main']['App']['UserHistory'](arg1);
+}
@@ -1,5 +1,217 @@
 export namespace backend {
 	
+	export class AlertStyle {
+	    Event: string;
+	    Text: string;
+	    Image: string;
+	    Sound: string;
+	    Seconds: number;
+	    MinAmount: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new AlertStyle(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Event = source["Event"];
+	        this.Text = source["Text"];
+	        this.Image = source["Image"];
+	        this.Sound = source["Sound"];
+	        this.Seconds = source["Seconds"];
+	        this.MinAmount = source["MinAmount"];
+	    }
+	}
+	export class ChannelPoint {
+	    Id: string;
+	    Title: string;
+	    Cost: number;
+	    Enabled: boolean;
+	    Paused: boolean;
+	    Prompt: string;
+	    BackgroundColor: string;
+	    UserInputRequired: boolean;
+	    MaxPerStream: number;
+	    MaxPerUserPerStream: number;
+	    GlobalCooldownSeconds: number;
+	    SkipRequestQueue: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new ChannelPoint(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Id = source["Id"];
+	        this.Title = source["Title"];
+	        this.Cost = source["Cost"];
+	        this.Enabled = source["Enabled"];
+	        this.Paused = source["Paused"];
+	        this.Prompt = source["Prompt"];
+	        this.BackgroundColor = source["BackgroundColor"];
+	        this.UserInputRequired = source["UserInputRequired"];
+	        this.MaxPerStream = source["MaxPerStream"];
+	        this.MaxPerUserPerStream = source["MaxPerUserPerStream"];
+	        this.GlobalCooldownSeconds = source["GlobalCooldownSeconds"];
+	        this.SkipRequestQueue = source["SkipRequestQueue"];
+	    }
+	}
+	export class Redemption {
+	    Id: string;
+	    RewardId: string;
+	    RewardTitle: string;
+	    Cost: number;
+	    UserName: string;
+	    UserLogin: string;
+	    UserInput: string;
+	    Status: string;
+	    RedeemedAt: any;
+	
+	    static createFrom(source: any = {}) {
+	        return new Redemption(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Id = source["Id"];
+	        this.RewardId = source["RewardId"];
+	        this.RewardTitle = source["RewardTitle"];
+	        this.Cost = source["Cost"];
+	        this.UserName = source["UserName"];
+	        this.UserLogin = source["UserLogin"];
+	        this.UserInput = source["UserInput"];
+	        this.Status = source["Status"];
+	        this.RedeemedAt = source["RedeemedAt"];
+	    }
+	}
+	export class RewardAction {
+	    Reward: string;
+	    SoundFile: string;
+	    MediaFile: string;
+	    ObsScene: string;
+	    ObsSource: string;
+	    ObsSourceScene: string;
+	    Seconds: number;
+	    AutoFulfill: boolean;
+	    RefundOnError: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new RewardAction(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Reward = source["Reward"];
+	        this.SoundFile = source["SoundFile"];
+	        this.MediaFile = source["MediaFile"];
+	        this.ObsScene = source["ObsScene"];
+	        this.ObsSource = source["ObsSource"];
+	        this.ObsSourceScene = source["ObsSourceScene"];
+	        this.Seconds = source["Seconds"];
+	        this.AutoFulfill = source["AutoFulfill"];
+	        this.RefundOnError = source["RefundOnError"];
+	    }
+	}
+	export class RewardSet {
+	    Name: string;
+	    Enabled: boolean;
+	    Rewards: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new RewardSet(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Name = source["Name"];
+	        this.Enabled = source["Enabled"];
+	        this.Rewards = source["Rewards"];
+	    }
+	}
+	export class RuleAction {
+	    Type: string;
+	    File: string;
+	    Text: string;
+	    Scene: string;
+	    Source: string;
+	    Seconds: number;
+	    Field: string;
+	    Count: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new RuleAction(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Type = source["Type"];
+	        this.File = source["File"];
+	        this.Text = source["Text"];
+	        this.Scene = source["Scene"];
+	        this.Source = source["Source"];
+	        this.Seconds = source["Seconds"];
+	        this.Field = source["Field"];
+	        this.Count = source["Count"];
+	    }
+	}
+	export class RuleCondition {
+	    Field: string;
+	    Min?: number;
+	    Max?: number;
+	    Equals: string;
+	    In: string[];
+	    Regex: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new RuleCondition(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Field = source["Field"];
+	        this.Min = source["Min"];
+	        this.Max = source["Max"];
+	        this.Equals = source["Equals"];
+	        this.In = source["In"];
+	        this.Regex = source["Regex"];
+	    }
+	}
+	export class Rule {
+	    Name: string;
+	    Event: string;
+	    Match: RuleCondition[];
+	    Actions: RuleAction[];
+	
+	    static createFrom(source: any = {}) {
+	        return new Rule(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Name = source["Name"];
+	        this.Event = source["Event"];
+	        this.Match = this.convertValues(source["Match"], RuleCondition);
+	        this.Actions = this.convertValues(source["Actions"], RuleAction);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
 	export class UserClip {
 	    Id: string;
 	    Url: string;
@@ -24,6 +236,60 @@ export namespace backend {
 	        this.Mp4 = source["Mp4"];
 	    }
 	}
+	export class PlaybackState {
+	    State: string;
+	    Src: string;
+	    Origin: string;
+	    Reason: string;
+	    UpdatedAt: any;
+	
+	    static createFrom(source: any = {}) {
+	        return new PlaybackState(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.State = source["State"];
+	        this.Src = source["Src"];
+	        this.Origin = source["Origin"];
+	        this.Reason = source["Reason"];
+	        this.UpdatedAt = source["UpdatedAt"];
+	    }
+	}
+	export class PlaylistState {
+	    Items: UserClip[];
+	    Current: number;
+	    Playing: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new PlaylistState(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Items = this.convertValues(source["Items"], UserClip);
+	        this.Current = source["Current"];
+	        this.Playing = source["Playing"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
 	export class RaidCallbackParam {
 	    From: string;
 	    Clips: UserClip[];
@@ -56,6 +322,120 @@ export namespace backend {
 		    return a;
 		}
 	}
+	export class HistorySub {
+	    Time: any;
+	    Type: string;
+	    Tier: string;
+	    Months: number;
+	    IsGift: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new HistorySub(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Time = source["Time"];
+	        this.Type = source["Type"];
+	        this.Tier = source["Tier"];
+	        this.Months = source["Months"];
+	        this.IsGift = source["IsGift"];
+	    }
+	}
+	export class HistoryRaid {
+	    Time: any;
+	    Viewers: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new HistoryRaid(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Time = source["Time"];
+	        this.Viewers = source["Viewers"];
+	    }
+	}
+	export class MonthlyTotal {
+	    Month: string;
+	    Streams: number;
+	    Follows: number;
+	    Subs: number;
+	    SubGifts: number;
+	    Bits: number;
+	    Raids: number;
+	    Chats: number;
+	    Redemptions: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new MonthlyTotal(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Month = source["Month"];
+	        this.Streams = source["Streams"];
+	        this.Follows = source["Follows"];
+	        this.Subs = source["Subs"];
+	        this.SubGifts = source["SubGifts"];
+	        this.Bits = source["Bits"];
+	        this.Raids = source["Raids"];
+	        this.Chats = source["Chats"];
+	        this.Redemptions = source["Redemptions"];
+	    }
+	}
+	export class UserHistory {
+	    Login: string;
+	    Name: string;
+	    FirstSeen: any;
+	    LastSeen: any;
+	    FirstFollow: any;
+	    Subs: HistorySub[];
+	    SubGifts: number;
+	    TotalBits: number;
+	    Raids: HistoryRaid[];
+	    Chats: number;
+	    Redemptions: number;
+	    Streams: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new UserHistory(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Login = source["Login"];
+	        this.Name = source["Name"];
+	        this.FirstSeen = source["FirstSeen"];
+	        this.LastSeen = source["LastSeen"];
+	        this.FirstFollow = source["FirstFollow"];
+	        this.Subs = this.convertValues(source["Subs"], HistorySub);
+	        this.SubGifts = source["SubGifts"];
+	        this.TotalBits = source["TotalBits"];
+	        this.Raids = this.convertValues(source["Raids"], HistoryRaid);
+	        this.Chats = source["Chats"];
+	        this.Redemptions = source["Redemptions"];
+	        this.Streams = source["Streams"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
 
 }
 
@@ -74,11 +454,32 @@ export namespace main {
 	    DelaySecondsFromRaidToStop: number;
 	    NewClipWatchIntervalSecond: number;
 	    LocalServerPortNumber: number;
+	    ServerBindAddress: string;
+	    OverlayAccessToken: string;
+	    ControlAllowedOrigins: string[];
 	    OverlayEnabled: boolean;
+	    OverlayDirectory: string;
 	    ClipPlayerWidth: number;
 	    ClipPlayerHeight: number;
+	    ClipGapSeconds: number;
+	    ClipCacheDirectory: string;
+	    ClipCacheMaxMegaBytes: number;
+	    ClipCacheMaxHours: number;
+	    ChatOverlayMaxLines: number;
+	    ChatOverlayFadeSeconds: number;
+	    SubGoalPoints: number;
+	    ControlApiToken: string;
+	    HistoryRetentionDays: number;
 	    LogTopIndent: string;
 	    LogUserNamePrefix: string;
+	    SummaryTemplateFile: string;
+	    SummaryOrder: string;
+	    SummarySectionOrder: {[key: string]: string};
+	    RewardSetList: backend.RewardSet[];
+	    RewardActionList: backend.RewardAction[];
+	    RuleList: backend.Rule[];
+	    RulesDryRun: boolean;
+	    AlertList: backend.AlertStyle[];
 	
 	    static createFrom(source: any = {}) {
 	        return new AppConfig(source);
@@ -98,12 +499,51 @@ export namespace main {
 	        this.DelaySecondsFromRaidToStop = source["DelaySecondsFromRaidToStop"];
 	        this.NewClipWatchIntervalSecond = source["NewClipWatchIntervalSecond"];
 	        this.LocalServerPortNumber = source["LocalServerPortNumber"];
+	        this.ServerBindAddress = source["ServerBindAddress"];
+	        this.OverlayAccessToken = source["OverlayAccessToken"];
+	        this.ControlAllowedOrigins = source["ControlAllowedOrigins"];
 	        this.OverlayEnabled = source["OverlayEnabled"];
+	        this.OverlayDirectory = source["OverlayDirectory"];
 	        this.ClipPlayerWidth = source["ClipPlayerWidth"];
 	        this.ClipPlayerHeight = source["ClipPlayerHeight"];
+	        this.ClipGapSeconds = source["ClipGapSeconds"];
+	        this.ClipCacheDirectory = source["ClipCacheDirectory"];
+	        this.ClipCacheMaxMegaBytes = source["ClipCacheMaxMegaBytes"];
+	        this.ClipCacheMaxHours = source["ClipCacheMaxHours"];
+	        this.ChatOverlayMaxLines = source["ChatOverlayMaxLines"];
+	        this.ChatOverlayFadeSeconds = source["ChatOverlayFadeSeconds"];
+	        this.SubGoalPoints = source["SubGoalPoints"];
+	        this.ControlApiToken = source["ControlApiToken"];
+	        this.HistoryRetentionDays = source["HistoryRetentionDays"];
 	        this.LogTopIndent = source["LogTopIndent"];
 	        this.LogUserNamePrefix = source["LogUserNamePrefix"];
+	        this.SummaryTemplateFile = source["SummaryTemplateFile"];
+	        this.SummaryOrder = source["SummaryOrder"];
+	        this.SummarySectionOrder = source["SummarySectionOrder"];
+	        this.RewardSetList = this.convertValues(source["RewardSetList"], backend.RewardSet);
+	        this.RewardActionList = this.convertValues(source["RewardActionList"], backend.RewardAction);
+	        this.RuleList = this.convertValues(source["RuleList"], backend.Rule);
+	        this.RulesDryRun = source["RulesDryRun"];
+	        this.AlertList = this.convertValues(source["AlertList"], backend.AlertStyle);
 	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
 	}
 
 }